@@ -0,0 +1,96 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package capi
+
+import (
+	"context"
+	"fmt"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/k8s"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/variables"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	autoscalerMaxSizeAnnotation     = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size"
+	autoscalerKubeconfigSecretName  = "cluster-autoscaler-management-kubeconfig"
+	autoscalerKubeconfigSecretField = "value"
+	autoscalerNamespace             = "kube-system"
+	autoscalerServiceAccountName    = "%s-cluster-autoscaler"
+)
+
+// autoscalerRules lets the cluster autoscaler scale the MachineDeployments in the cluster namespace, and mark the Machines to remove.
+// The autoscaler scales MachineDeployments by updating their scale subresource.
+var autoscalerRules = []rbacv1.PolicyRule{
+	{
+		APIGroups: []string{"cluster.x-k8s.io"},
+		Resources: []string{"machinedeployments", "machinedeployments/scale", "machines", "machinesets"},
+		Verbs:     []string{"get", "list", "watch", "patch"},
+	},
+	{
+		APIGroups: []string{"cluster.x-k8s.io"},
+		Resources: []string{"machinedeployments/scale"},
+		Verbs:     []string{"update"},
+	},
+}
+
+// preserveAutoscaledReplicas keeps the live replica count of autoscaled objects, since the cluster autoscaler owns it
+func preserveAutoscaledReplicas(existing, u *unstructured.Unstructured) error {
+	if _, ok := u.GetAnnotations()[autoscalerMaxSizeAnnotation]; !ok {
+		return nil
+	}
+	replicas, found, err := unstructured.NestedFieldCopy(existing.Object, "spec", "replicas")
+	if err != nil || !found {
+		return err
+	}
+	return unstructured.SetNestedField(u.Object, replicas, "spec", "replicas")
+}
+
+// autoscalerServiceAccount is the admin cluster service account of the managed cluster autoscaler, limited to the cluster namespace
+func autoscalerServiceAccount(v *variables.Variables) *k8s.ServiceAccount {
+	sa := k8s.NewServiceAccount()
+	sa.Name = fmt.Sprintf(autoscalerServiceAccountName, v.Name)
+	sa.Namespace = v.Namespace
+	sa.ClusterRole = ""
+	sa.Rules = autoscalerRules
+	return sa
+}
+
+// createOrUpdateAutoscalerKubeconfig gives the managed cluster autoscaler access to the cluster's MachineDeployments on the admin cluster.
+// The kubeconfig authenticates as the autoscaler service account, so the admin cluster credentials are never copied to the managed cluster.
+func createOrUpdateAutoscalerKubeconfig(ctx context.Context, adminKi, ki kubernetes.Interface, v *variables.Variables) error {
+	sa := autoscalerServiceAccount(v)
+	token, err := sa.Token(ctx, adminKi)
+	if err != nil {
+		return err
+	}
+	kubeconfig, err := k8s.NewKubeconfigForToken(k8s.InjectedKubeConfig, sa.Name, token)
+	if err != nil {
+		return err
+	}
+	data := map[string][]byte{
+		autoscalerKubeconfigSecretField: kubeconfig,
+	}
+	current, err := ki.CoreV1().Secrets(autoscalerNamespace).Get(ctx, autoscalerKubeconfigSecretName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			_, err := ki.CoreV1().Secrets(autoscalerNamespace).Create(ctx, &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      autoscalerKubeconfigSecretName,
+					Namespace: autoscalerNamespace,
+				},
+				Data: data,
+			}, metav1.CreateOptions{})
+			return err
+		}
+		return err
+	}
+	current.Data = data
+	_, err = ki.CoreV1().Secrets(autoscalerNamespace).Update(ctx, current, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package capi
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/capi/object"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/gvr"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/k8s"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/templates"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/variables"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fake2 "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd"
+	"testing"
+)
+
+func TestPreserveAutoscaledReplicas(t *testing.T) {
+	ctx := context.TODO()
+	v := *testVariables
+	v.NodePools = []variables.NodePool{
+		{
+			Name:        "autoscaled",
+			Replicas:    1,
+			MinReplicas: 1,
+			MaxReplicas: 5,
+		},
+		{
+			Name:     "fixed",
+			Replicas: 2,
+		},
+	}
+	mds, err := loadTextTemplate(object.Object{Text: templates.MachineDeployment}, v)
+	assert.NoError(t, err)
+	assert.Len(t, mds, 2)
+	assert.Equal(t, "5", mds[0].GetAnnotations()[autoscalerMaxSizeAnnotation])
+	assert.Equal(t, "1", mds[0].GetAnnotations()["cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size"])
+	assert.Empty(t, mds[1].GetAnnotations())
+
+	// the autoscaler has scaled both machine deployments
+	var existing []runtime.Object
+	for idx := range mds {
+		md := mds[idx].DeepCopy()
+		assert.NoError(t, unstructured.SetNestedField(md.Object, int64(4), "spec", "replicas"))
+		existing = append(existing, md)
+	}
+	di := fake2.NewSimpleDynamicClient(runtime.NewScheme(), existing...)
+	_, err = createOrUpdateObjects(ctx, di, []object.Object{{Text: templates.MachineDeployment}}, &v)
+	assert.NoError(t, err)
+
+	autoscaled, err := di.Resource(gvr.MachineDeployment).Namespace(v.Namespace).Get(ctx, "autoscaled", metav1.GetOptions{})
+	assert.NoError(t, err)
+	replicas, _, _ := unstructured.NestedInt64(autoscaled.Object, "spec", "replicas")
+	assert.Equal(t, int64(4), replicas)
+
+	fixed, err := di.Resource(gvr.MachineDeployment).Namespace(v.Namespace).Get(ctx, "fixed", metav1.GetOptions{})
+	assert.NoError(t, err)
+	replicas, _, _ = unstructured.NestedInt64(fixed.Object, "spec", "replicas")
+	assert.Equal(t, int64(2), replicas)
+}
+
+const testAdminKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: admin
+  cluster:
+    server: https://admin.example.com:6443
+    certificate-authority-data: Y2E=
+users:
+- name: admin
+  user:
+    client-certificate-data: Y2VydA==
+    client-key-data: a2V5
+contexts:
+- name: admin
+  context:
+    cluster: admin
+    user: admin
+current-context: admin
+`
+
+func TestCreateOrUpdateAutoscalerKubeconfig(t *testing.T) {
+	ctx := context.TODO()
+	injected := k8s.InjectedKubeConfig
+	defer func() {
+		k8s.InjectedKubeConfig = injected
+	}()
+	k8s.InjectedKubeConfig = []byte(testAdminKubeconfig)
+
+	adminKi := fake.NewSimpleClientset()
+	// populate the token secret, like the token controller
+	adminKi.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		secret := action.(k8stesting.CreateAction).GetObject().(*v1.Secret)
+		secret.Data = map[string][]byte{
+			v1.ServiceAccountTokenKey: []byte("autoscaler-token"),
+		}
+		return false, nil, nil
+	})
+	ki := fake.NewSimpleClientset()
+	assert.NoError(t, createOrUpdateAutoscalerKubeconfig(ctx, adminKi, ki, testVariables))
+	assert.NoError(t, createOrUpdateAutoscalerKubeconfig(ctx, adminKi, ki, testVariables))
+
+	secret, err := ki.CoreV1().Secrets(autoscalerNamespace).Get(ctx, autoscalerKubeconfigSecretName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	kubeconfig := secret.Data[autoscalerKubeconfigSecretField]
+	assert.NotEqual(t, k8s.InjectedKubeConfig, kubeconfig)
+
+	// the kubeconfig has the admin cluster endpoint, and only the autoscaler service account token
+	config, err := clientcmd.Load(kubeconfig)
+	assert.NoError(t, err)
+	assert.Len(t, config.AuthInfos, 1)
+	user := config.AuthInfos[config.Contexts[config.CurrentContext].AuthInfo]
+	assert.Equal(t, "autoscaler-token", user.Token)
+	assert.Empty(t, user.ClientCertificateData)
+	assert.Empty(t, user.ClientKeyData)
+	cluster := config.Clusters[config.Contexts[config.CurrentContext].Cluster]
+	assert.Equal(t, "https://admin.example.com:6443", cluster.Server)
+	assert.Equal(t, []byte("ca"), cluster.CertificateAuthorityData)
+
+	// the service account can only manage Cluster API resources in the cluster namespace
+	name := testVariables.Name + "-cluster-autoscaler"
+	role, err := adminKi.RbacV1().Roles(testVariables.Namespace).Get(ctx, name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, autoscalerRules, role.Rules)
+	binding, err := adminKi.RbacV1().RoleBindings(testVariables.Namespace).Get(ctx, name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, name, binding.RoleRef.Name)
+	assert.Equal(t, name, binding.Subjects[0].Name)
+	bindings, err := adminKi.RbacV1().ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, bindings.Items)
+}
@@ -38,6 +38,11 @@ const (
 	machinePhaseRunning     = "Running"
 )
 
+const (
+	nodePoolLabel           = "verrazzano.io/node-pool"
+	machineHealthCheckLabel = "verrazzano.io/machine-health-check"
+)
+
 type CAPIClient struct {
 	verrazzanoTimeout         time.Duration
 	verrazzanoPollingInterval time.Duration
@@ -73,6 +78,10 @@ func (c *CAPIClient) CreateOrUpdateAllObjects(ctx context.Context, kubernetesInt
 // createOrUpdateCAPISecret creates the CAPI secret if it does not already exist
 // if the secret exists, update it in place with the new credentials
 func createOrUpdateCAPISecret(ctx context.Context, v *variables.Variables, client kubernetes.Interface) error {
+	// only user principals need a CAPI secret, other identities authenticate without credentials
+	if !v.UsesUserPrincipal() {
+		return nil
+	}
 	data := map[string][]byte{
 		ociTenancyField:              []byte(v.Tenancy),
 		ociUserField:                 []byte(v.User),
@@ -145,6 +154,12 @@ func cruObject(ctx context.Context, client dynamic.Interface, o object.Object, v
 				return cruResult, fmt.Errorf("get failed %s/%s/%s: %v", groupVersionResource.Group, groupVersionResource.Version, groupVersionResource.Resource, err)
 			}
 		} else { // If the Object exists, merge with existingObject and do an update
+			if err := preserveAutoscaledReplicas(existingObject, u); err != nil {
+				return cruResult, fmt.Errorf("replica preservation failed %s/%s/%s: %v", groupVersionResource.Group, groupVersionResource.Version, groupVersionResource.Resource, err)
+			}
+			if err := preserveNetworkIDs(existingObject, u); err != nil {
+				return cruResult, fmt.Errorf("network preservation failed %s/%s/%s: %v", groupVersionResource.Group, groupVersionResource.Version, groupVersionResource.Resource, err)
+			}
 			mergedObject := mergeUnstructured(existingObject, u, o.LockedFields)
 			if err != nil {
 				return cruResult, fmt.Errorf("merge failed %s/%s/%s: %v", groupVersionResource.Group, groupVersionResource.Version, groupVersionResource.Resource, err)
@@ -212,7 +227,10 @@ func (c *CAPIClient) DeleteCluster(ctx context.Context, di dynamic.Interface, ki
 		}
 	}
 	// Surface that the cluster is being deleted to the user
-	return errors.New("deleting cluster")
+	return &ProgressingError{
+		Phase:   PhaseDeleting,
+		Message: "deleting cluster",
+	}
 }
 
 func deleteUnstructureds(ctx context.Context, di dynamic.Interface, us []unstructured.Unstructured) error {
@@ -259,6 +277,62 @@ func deleteWorkerObjects(ctx context.Context, di dynamic.Interface, namespace st
 			}
 		}
 	}
+	if err := deleteOrphanedTemplates(ctx, di, gvr.OCIMachineTemplate, namespace, v); err != nil {
+		return err
+	}
+	if err := deleteOrphanedTemplates(ctx, di, gvr.OCNEConfigTemplate, namespace, v); err != nil {
+		return err
+	}
+	if err := deleteOrphanedMachineHealthChecks(ctx, di, namespace, v); err != nil {
+		return err
+	}
+	// node pools used to share a single OCNEConfigTemplate named after the cluster
+	return deleteIfExists(ctx, di, gvr.OCNEConfigTemplate, v.Name, namespace)
+}
+
+// deleteOrphanedMachineHealthChecks deletes the MachineHealthChecks of removed node pools, and of node pools or control planes that disabled them
+func deleteOrphanedMachineHealthChecks(ctx context.Context, di dynamic.Interface, namespace string, v *variables.Variables) error {
+	mhcs, err := di.Resource(gvr.MachineHealthCheck).Namespace(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: machineHealthCheckLabel,
+	})
+	if err != nil {
+		return err
+	}
+	current := map[string]bool{}
+	for _, mhc := range v.MachineHealthChecks() {
+		current[mhc.Name] = true
+	}
+	for _, mhc := range mhcs.Items {
+		if current[mhc.GetName()] {
+			continue
+		}
+		if err := deleteIfExists(ctx, di, gvr.MachineHealthCheck, mhc.GetName(), namespace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteOrphanedTemplates deletes node pool templates whose hash no longer matches any node pool
+func deleteOrphanedTemplates(ctx context.Context, di dynamic.Interface, resource schema.GroupVersionResource, namespace string, v *variables.Variables) error {
+	templates, err := di.Resource(resource).Namespace(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: nodePoolLabel,
+	})
+	if err != nil {
+		return err
+	}
+	current := map[string]bool{}
+	for _, np := range v.NodePools {
+		current[fmt.Sprintf("%s-%s", np.Name, np.Hash)] = true
+	}
+	for _, template := range templates.Items {
+		if current[template.GetName()] {
+			continue
+		}
+		if err := deleteIfExists(ctx, di, resource, template.GetName(), namespace); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
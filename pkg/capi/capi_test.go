@@ -9,15 +9,19 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/capi/object"
 	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/gvr"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/templates"
 	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/variables"
 	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/dynamic"
 	fake2 "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/fake"
 	"math/rand"
+	"strings"
 	"testing"
 	"time"
 )
@@ -117,15 +121,31 @@ func TestRenderObjects(t *testing.T) {
 				Ocpus:      8,
 				VolumeSize: 250,
 				Shape:      "xyz",
+
+				ActualImage:         "ocid1.image.oc1.iad.bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+				SSHPublicKey:        "ssh-rsa bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb foo@foo-mac",
+				SubnetId:            "ocid1.subnet.oc1.iad.bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+				FaultDomain:         "FAULT-DOMAIN-1",
+				BootVolumeVpusPerGB: 20,
+				Labels: map[string]string{
+					"workload": "batch",
+				},
+				Taints: []variables.Taint{
+					{Key: "dedicated", Value: "batch", Effect: "NoSchedule"},
+				},
+				KubeletExtraArgs: map[string]string{
+					"max-pods": "50",
+				},
 			},
 		},
 
-		InstallVerrazzano: true,
-		InstallCCM:        true,
-		InstallCalico:     true,
+		InstallVerrazzano:        true,
+		InstallCCM:               true,
+		InstallCalico:            true,
+		InstallClusterAutoscaler: true,
 	}
 
-	os := object.CreateObjects()
+	os := append(object.CreateObjects(), object.Modules(&v)...)
 	for _, o := range os {
 		u, err := loadTextTemplate(o, v)
 		assert.NoError(t, err)
@@ -133,6 +153,376 @@ func TestRenderObjects(t *testing.T) {
 	}
 }
 
+func TestRenderNodePoolConfig(t *testing.T) {
+	v := *testVariables
+	v.NodePools = []variables.NodePool{
+		{
+			Name: "np-1",
+			Hash: "abcde",
+		},
+		{
+			Name: "np-2",
+			Hash: "fghij",
+			Labels: map[string]string{
+				"workload": "batch",
+				"tier":     "backend",
+			},
+			Taints: []variables.Taint{
+				{Key: "dedicated", Value: "batch", Effect: "NoSchedule"},
+				{Key: "gpu", Effect: "NoExecute"},
+			},
+			KubeletExtraArgs: map[string]string{
+				"max-pods":    "50",
+				"node-labels": "zone=a",
+				"provider-id": "ignored",
+			},
+		},
+	}
+	configs, err := loadTextTemplate(object.Object{Text: templates.OCNEConfigTemplate}, v)
+	assert.NoError(t, err)
+	assert.Len(t, configs, 2)
+
+	assert.Equal(t, "np-1-abcde", configs[0].GetName())
+	assert.Equal(t, "np-1", configs[0].GetLabels()[nodePoolLabel])
+	args, err := object.NestedField(configs[0].Object, "spec", "template", "spec", "joinConfiguration", "nodeRegistration", "kubeletExtraArgs")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"cloud-provider": "external",
+		"provider-id":    variables.ProviderId,
+	}, args)
+
+	assert.Equal(t, "np-2-fghij", configs[1].GetName())
+	args, err = object.NestedField(configs[1].Object, "spec", "template", "spec", "joinConfiguration", "nodeRegistration", "kubeletExtraArgs")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"cloud-provider": "external",
+		"provider-id":    variables.ProviderId,
+		"max-pods":       "50",
+		"node-labels":    "zone=a,tier=backend,workload=batch",
+	}, args)
+	taints, err := object.NestedField(configs[1].Object, "spec", "template", "spec", "joinConfiguration", "nodeRegistration", "taints")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "dedicated", "value": "batch", "effect": "NoSchedule"},
+		map[string]interface{}{"key": "gpu", "effect": "NoExecute"},
+	}, taints)
+}
+
+func TestRenderMachineHealthChecks(t *testing.T) {
+	v := *testVariables
+	v.ControlPlaneMachineHealthCheck = true
+	v.MachineHealthCheckUnhealthyTimeout = "10m"
+	v.NodePools = []variables.NodePool{
+		{Name: "np-1"},
+		{
+			Name: "np-2",
+			MachineHealthCheck: &variables.MachineHealthCheck{
+				MaxUnhealthy: "1",
+				UnhealthyConditions: []variables.UnhealthyCondition{
+					{Type: "DiskPressure", Status: "True", Timeout: "1m"},
+				},
+			},
+		},
+	}
+	mhcs, err := loadTextTemplate(object.Object{Text: templates.MachineHealthCheck}, v)
+	assert.NoError(t, err)
+	assert.Len(t, mhcs, 2)
+
+	assert.Equal(t, "test-control-plane", mhcs[0].GetName())
+	assert.Equal(t, "control-plane", mhcs[0].GetLabels()[machineHealthCheckLabel])
+	spec := mhcs[0].Object["spec"].(map[string]interface{})
+	assert.Equal(t, variables.DefaultMachineHealthCheckMaxUnhealthy, spec["maxUnhealthy"])
+	assert.Equal(t, variables.DefaultMachineHealthCheckNodeStartupTimeout, spec["nodeStartupTimeout"])
+	assert.Equal(t, map[string]interface{}{"cluster.x-k8s.io/control-plane": ""}, spec["selector"].(map[string]interface{})["matchLabels"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "Ready", "status": "False", "timeout": "10m"},
+		map[string]interface{}{"type": "Ready", "status": "Unknown", "timeout": "10m"},
+	}, spec["unhealthyConditions"])
+
+	assert.Equal(t, "np-2", mhcs[1].GetName())
+	spec = mhcs[1].Object["spec"].(map[string]interface{})
+	assert.EqualValues(t, 1, spec["maxUnhealthy"])
+	assert.Equal(t, map[string]interface{}{"cluster.x-k8s.io/deployment-name": "np-2"}, spec["selector"].(map[string]interface{})["matchLabels"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "DiskPressure", "status": "True", "timeout": "1m"},
+	}, spec["unhealthyConditions"])
+
+	// no health checks renders an empty list
+	mhcs, err = loadTextTemplate(object.Object{Text: templates.MachineHealthCheck}, *testVariables)
+	assert.NoError(t, err)
+	assert.Len(t, mhcs, 0)
+}
+
+func TestRenderRolloutStrategy(t *testing.T) {
+	v := *testVariables
+	v.ControlPlaneReplicas = 3
+	v.ControlPlaneMaxSurge = "0"
+	v.ControlPlaneRolloutBeforeCertificatesExpiryDays = 30
+	v.NodePoolMaxUnavailable = "25%"
+	v.MinReadySeconds = 30
+	v.NodeDrainTimeout = "10m"
+	minReadySeconds := int64(0)
+	maxSurge := intstr.FromString("50%")
+	v.NodePools = []variables.NodePool{
+		{Name: "np-1"},
+		{
+			Name:             "np-2",
+			RolloutStrategy:  &variables.RolloutStrategy{MaxSurge: &maxSurge},
+			MinReadySeconds:  &minReadySeconds,
+			NodeDrainTimeout: "1h",
+		},
+	}
+
+	controlPlanes, err := loadTextTemplate(object.Object{Text: templates.OCNEControlPlane}, v)
+	assert.NoError(t, err)
+	assert.Len(t, controlPlanes, 1)
+	spec := controlPlanes[0].Object["spec"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"type":          "RollingUpdate",
+		"rollingUpdate": map[string]interface{}{"maxSurge": int64(0)},
+	}, spec["rolloutStrategy"])
+	assert.Equal(t, map[string]interface{}{"certificatesExpiryDays": int64(30)}, spec["rolloutBefore"])
+	// unset values are rendered as null, so they are removed from existing objects
+	rolloutAfter, ok := spec["rolloutAfter"]
+	assert.True(t, ok)
+	assert.Nil(t, rolloutAfter)
+	drainTimeout, err := object.NestedField(controlPlanes[0].Object, "spec", "machineTemplate", "nodeDrainTimeout")
+	assert.NoError(t, err)
+	assert.Equal(t, "10m", drainTimeout)
+
+	deployments, err := loadTextTemplate(object.Object{Text: templates.MachineDeployment}, v)
+	assert.NoError(t, err)
+	assert.Len(t, deployments, 2)
+	var tests = []struct {
+		minReadySeconds  int64
+		rollingUpdate    map[string]interface{}
+		nodeDrainTimeout string
+	}{
+		{
+			30,
+			map[string]interface{}{"maxSurge": int64(1), "maxUnavailable": "25%"},
+			"10m",
+		},
+		{
+			0,
+			map[string]interface{}{"maxSurge": "50%", "maxUnavailable": "25%"},
+			"1h",
+		},
+	}
+	for i, tt := range tests {
+		spec = deployments[i].Object["spec"].(map[string]interface{})
+		assert.Equal(t, tt.minReadySeconds, spec["minReadySeconds"])
+		assert.Equal(t, map[string]interface{}{
+			"type":          "RollingUpdate",
+			"rollingUpdate": tt.rollingUpdate,
+		}, spec["strategy"])
+		drainTimeout, err = object.NestedField(deployments[i].Object, "spec", "template", "spec", "nodeDrainTimeout")
+		assert.NoError(t, err)
+		assert.Equal(t, tt.nodeDrainTimeout, drainTimeout)
+	}
+}
+
+func TestRenderQuickCreateNetwork(t *testing.T) {
+	v := *testVariables
+	v.QuickCreateVCN = true
+	v.ClusterCIDR = "10.96.0.0/16"
+	v.VCNCIDR = "172.16.0.0/16"
+	clusters, err := loadTextTemplate(object.Object{Text: templates.OCICluster}, v)
+	assert.NoError(t, err)
+	assert.Len(t, clusters, 1)
+
+	vcn, err := object.NestedField(clusters[0].Object, "spec", "networkSpec", "vcn")
+	assert.NoError(t, err)
+	assert.Equal(t, "172.16.0.0/16", vcn.(map[string]interface{})["cidr"])
+	subnets, err := object.NestedField(vcn, "subnets")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"cidr": "172.16.0.8/29", "name": "ocne-control-plane-endpoint", "role": "control-plane-endpoint", "type": "public"},
+		map[string]interface{}{"cidr": "172.16.0.0/29", "name": "ocne-control-plane", "role": "control-plane", "type": "private"},
+		map[string]interface{}{"cidr": "172.16.0.32/27", "name": "ocne-service-lb", "role": "service-lb", "type": "public"},
+		map[string]interface{}{"cidr": "172.16.64.0/20", "name": "ocne-worker", "role": "worker", "type": "private"},
+	}, subnets)
+
+	nsgs, err := object.NestedField(vcn, "networkSecurityGroup", "list")
+	assert.NoError(t, err)
+	assert.Len(t, nsgs, 4)
+	endpoint := nsgs.([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "control-plane-endpoint", endpoint["role"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"egressRule": map[string]interface{}{
+				"description":     "Kubernetes API traffic to Control Plane",
+				"destination":     "172.16.0.0/29",
+				"destinationType": "CIDR_BLOCK",
+				"isStateless":     false,
+				"protocol":        "6",
+				"tcpOptions": map[string]interface{}{
+					"destinationPortRange": map[string]interface{}{"max": int64(6443), "min": int64(6443)},
+				},
+			},
+		},
+	}, endpoint["egressRules"])
+	pathDiscovery := endpoint["ingressRules"].([]interface{})[2].(map[string]interface{})["ingressRule"]
+	assert.Equal(t, map[string]interface{}{
+		"description": "ICMP Path discovery",
+		"source":      "172.16.0.0/16",
+		"sourceType":  "CIDR_BLOCK",
+		"isStateless": false,
+		"protocol":    "1",
+		"icmpOptions": map[string]interface{}{"code": int64(4), "type": int64(3)},
+	}, pathDiscovery)
+	_, err = object.NestedField(vcn, "internetGateway")
+	assert.Error(t, err)
+
+	// private clusters have no internet gateway or public subnets
+	v.PrivateCluster = true
+	clusters, err = loadTextTemplate(object.Object{Text: templates.OCICluster}, v)
+	assert.NoError(t, err)
+	skip, err := object.NestedField(clusters[0].Object, "spec", "networkSpec", "vcn", "internetGateway", "skip")
+	assert.NoError(t, err)
+	assert.Equal(t, true, skip)
+	subnets, err = object.NestedField(clusters[0].Object, "spec", "networkSpec", "vcn", "subnets")
+	assert.NoError(t, err)
+	for _, subnet := range subnets.([]interface{}) {
+		assert.Equal(t, "private", subnet.(map[string]interface{})["type"])
+	}
+}
+
+func TestRenderExistingNetworkSecurityGroups(t *testing.T) {
+	v := *testVariables
+	clusters, err := loadTextTemplate(object.Object{Text: templates.OCICluster}, v)
+	assert.NoError(t, err)
+	_, err = object.NestedField(clusters[0].Object, "spec", "networkSpec", "vcn", "networkSecurityGroup")
+	assert.Error(t, err)
+
+	v.NetworkSecurityGroups = []variables.NetworkSecurityGroup{
+		{Id: "ocid1.networksecuritygroup.cp", Name: "control-plane", Role: "control-plane"},
+		{Id: "ocid1.networksecuritygroup.worker", Name: "worker", Role: "worker"},
+	}
+	clusters, err = loadTextTemplate(object.Object{Text: templates.OCICluster}, v)
+	assert.NoError(t, err)
+	nsgs, err := object.NestedField(clusters[0].Object, "spec", "networkSpec", "vcn", "networkSecurityGroup", "list")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"id": "ocid1.networksecuritygroup.cp", "name": "control-plane", "role": "control-plane"},
+		map[string]interface{}{"id": "ocid1.networksecuritygroup.worker", "name": "worker", "role": "worker"},
+	}, nsgs)
+}
+
+func TestRenderNoProxy(t *testing.T) {
+	var tests = []struct {
+		name           string
+		quickCreateVCN bool
+		vcnCIDR        string
+		existingCIDRs  []string
+		noProxy        string
+	}{
+		{"quick create VCN in the cluster CIDR", true, "", nil, "10.96.0.0/16,192.168.0.0/16"},
+		{"quick create VCN CIDR", true, "172.16.0.0/16", nil, "10.96.0.0/16,192.168.0.0/16,172.16.0.0/16"},
+		{"existing VCN", false, "", []string{"10.0.0.0/16", "10.1.0.0/16"}, "10.96.0.0/16,192.168.0.0/16,10.0.0.0/16,10.1.0.0/16"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := *testVariables
+			v.ProxyEndpoint = "http://proxy:3128"
+			v.ClusterCIDR = "10.96.0.0/16"
+			v.PodCIDR = "192.168.0.0/16"
+			v.QuickCreateVCN = tt.quickCreateVCN
+			v.VCNCIDR = tt.vcnCIDR
+			v.ExistingVCNCIDRs = tt.existingCIDRs
+			v.NodePools = []variables.NodePool{{Name: "np-1"}}
+
+			controlPlanes, err := loadTextTemplate(object.Object{Text: templates.OCNEControlPlane}, v)
+			assert.NoError(t, err)
+			noProxy, err := object.NestedField(controlPlanes[0].Object, "spec", "controlPlaneConfig", "imageConfiguration", "proxy", "noProxy")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.noProxy, noProxy)
+
+			configs, err := loadTextTemplate(object.Object{Text: templates.OCNEConfigTemplate}, v)
+			assert.NoError(t, err)
+			noProxy, err = object.NestedField(configs[0].Object, "spec", "template", "spec", "imageConfiguration", "proxy", "noProxy")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.noProxy, noProxy)
+		})
+	}
+}
+
+func TestRenderCCMSecretSubnets(t *testing.T) {
+	v := *testVariables
+	v.ControlPlaneEndpointSubnet = "ocid1.subnet.oc1.iad.endpoint"
+	secret, err := loadTextTemplate(object.Object{Text: templates.CCMSecret}, v)
+	assert.NoError(t, err)
+	config, err := object.NestedField(secret[0].Object, "stringData", "cloud-provider.yaml")
+	assert.NoError(t, err)
+	// service load balancers only use the load balancer subnet, never the API endpoint subnet
+	assert.Contains(t, config, "subnet1: "+v.LoadBalancerSubnet)
+	assert.NotContains(t, config, v.ControlPlaneEndpointSubnet)
+}
+
+func TestRenderAuthMode(t *testing.T) {
+	var tests = []struct {
+		name              string
+		authMode          string
+		identityType      string
+		instancePrincipal bool
+	}{
+		{"default", "", "UserPrincipal", false},
+		{"user principal", variables.AuthModeUserPrincipal, "UserPrincipal", false},
+		{"instance principal", variables.AuthModeInstancePrincipal, "InstancePrincipal", true},
+		{"workload identity", variables.AuthModeWorkloadIdentity, "Workload", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := *testVariables
+			v.AuthMode = tt.authMode
+			v.CAPICredentialName = "creds"
+			v.CAPIOCINamespace = variables.CAPIOCINamespace
+
+			identity, err := loadTextTemplate(object.Object{Text: templates.ClusterIdentity}, v)
+			assert.NoError(t, err)
+			identityType, err := object.NestedField(identity[0].Object, "spec", "type")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.identityType, identityType)
+			_, err = object.NestedField(identity[0].Object, "spec", "principalSecret")
+			assert.Equal(t, tt.instancePrincipal, err != nil)
+
+			for _, secretTemplate := range []string{templates.CCMSecret, templates.CSISecret} {
+				secret, err := loadTextTemplate(object.Object{Text: secretTemplate}, v)
+				assert.NoError(t, err)
+				stringData, err := object.NestedField(secret[0].Object, "stringData")
+				assert.NoError(t, err)
+				for _, config := range stringData.(map[string]interface{}) {
+					assert.Contains(t, config, fmt.Sprintf("useInstancePrincipals: %v", tt.instancePrincipal))
+					assert.Equal(t, !tt.instancePrincipal, strings.Contains(config.(string), "fingerprint:"))
+				}
+			}
+		})
+	}
+}
+
+func TestCreateOrUpdateCAPISecret(t *testing.T) {
+	ctx := context.TODO()
+	v := *testVariables
+	v.CAPICredentialName = "creds"
+	v.CAPIOCINamespace = variables.CAPIOCINamespace
+
+	ki := fake.NewSimpleClientset()
+	v.AuthMode = variables.AuthModeInstancePrincipal
+	assert.NoError(t, createOrUpdateCAPISecret(ctx, &v, ki))
+	secrets, err := ki.CoreV1().Secrets(v.CAPIOCINamespace).List(ctx, metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, secrets.Items)
+
+	v.AuthMode = variables.AuthModeUserPrincipal
+	assert.NoError(t, createOrUpdateCAPISecret(ctx, &v, ki))
+	secret, err := ki.CoreV1().Secrets(v.CAPIOCINamespace).Get(ctx, v.CAPICredentialName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "u", string(secret.Data[ociUserField]))
+	assert.Equal(t, "false", string(secret.Data[ociUseInstancePrincipalField]))
+}
+
 func TestDeleteCluster(t *testing.T) {
 	cluster := createTestCluster(testVariables, true, true, clusterPhaseProvisioned)
 	ki := fake.NewSimpleClientset()
@@ -161,6 +551,7 @@ func TestDeleteCluster(t *testing.T) {
 					assert.Fail(t, "expected progress message")
 				}
 				assert.Equal(t, "deleting cluster", err.Error())
+				assert.True(t, IsProgressing(err))
 			}
 		})
 	}
@@ -199,16 +590,38 @@ func createTestCluster(v *variables.Variables, cReady, iReady bool, phase string
 	return &cluster[0]
 }
 
-func createTestDIWithClusterAndMachine() dynamic.Interface {
+func createTestDIWithClusterAndMachine(objects ...runtime.Object) dynamic.Interface {
 	cluster := createTestCluster(testVariables, true, true, clusterPhaseProvisioned)
 	machine := createTestMachine(testVariables, machinePhaseRunning)
+	return fake2.NewSimpleDynamicClient(createTestScheme(), append([]runtime.Object{cluster, machine}, objects...)...)
+}
+
+func createTestScheme() *runtime.Scheme {
 	scheme := runtime.NewScheme()
-	scheme.AddKnownTypeWithName(listGVK(machine), &unstructured.UnstructuredList{})
+	scheme.AddKnownTypeWithName(schema.GroupVersionKind{
+		Group:   gvr.Machine.Group,
+		Version: gvr.Machine.Version,
+		Kind:    "MachineList",
+	}, &unstructured.UnstructuredList{})
 	scheme.AddKnownTypeWithName(schema.GroupVersionKind{
 		Group:   gvr.MachineDeployment.Group,
 		Version: gvr.MachineDeployment.Version,
 		Kind:    "MachineDeploymentList",
 	}, &unstructured.UnstructuredList{})
-	di := fake2.NewSimpleDynamicClient(scheme, cluster, machine)
-	return di
+	scheme.AddKnownTypeWithName(schema.GroupVersionKind{
+		Group:   gvr.OCIMachineTemplate.Group,
+		Version: gvr.OCIMachineTemplate.Version,
+		Kind:    "OCIMachineTemplateList",
+	}, &unstructured.UnstructuredList{})
+	scheme.AddKnownTypeWithName(schema.GroupVersionKind{
+		Group:   gvr.MachineHealthCheck.Group,
+		Version: gvr.MachineHealthCheck.Version,
+		Kind:    "MachineHealthCheckList",
+	}, &unstructured.UnstructuredList{})
+	scheme.AddKnownTypeWithName(schema.GroupVersionKind{
+		Group:   gvr.OCNEConfigTemplate.Group,
+		Version: gvr.OCNEConfigTemplate.Version,
+		Kind:    "OCNEConfigTemplateList",
+	}, &unstructured.UnstructuredList{})
+	return scheme
 }
@@ -0,0 +1,176 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package capi
+
+import (
+	"context"
+	"fmt"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/capi/object"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/templates"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/variables"
+	"gopkg.in/yaml.v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"strings"
+	"time"
+)
+
+const (
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+	kubeSystemNamespace   = "kube-system"
+
+	capociControllerManager = "capoci-controller-manager"
+	ccmDaemonSet            = "oci-cloud-controller-manager"
+	csiControllerDeployment = "csi-oci-controller"
+	csiNodeDaemonSet        = "csi-oci-node"
+)
+
+// credentialSecrets are the managed cluster secrets with the OCI config of the CCM and CSI
+var credentialSecrets = []struct {
+	name string
+	key  string
+	text string
+}{
+	{"oci-cloud-controller-manager", "cloud-provider.yaml", templates.CCMSecret},
+	{"oci-volume-provisioner", "config.yaml", templates.CSISecret},
+}
+
+// CredentialRotation reports the consumers of the OCI credentials that were updated after the cloud credential was rotated
+type CredentialRotation struct {
+	Updated []string
+}
+
+func (r *CredentialRotation) String() string {
+	if r == nil || len(r.Updated) < 1 {
+		return "no OCI credential consumers updated"
+	}
+	return fmt.Sprintf("updated OCI credential consumers: %s", strings.Join(r.Updated, ", "))
+}
+
+// RotateCredentials pushes the cloud credential to every consumer of the OCI credentials when the credential's API key fingerprint changes.
+// The CAPI secret and the managed cluster CCM and CSI secrets are updated, and their consumers are restarted to load the new credentials.
+// If no rotation happened, the returned CredentialRotation is nil.
+func (c *CAPIClient) RotateCredentials(ctx context.Context, adminKi, managedKi kubernetes.Interface, managedDi dynamic.Interface, v *variables.Variables) (*CredentialRotation, error) {
+	if !v.UsesUserPrincipal() || v.AppliedFingerprint == v.Fingerprint {
+		return nil, nil
+	}
+	// clusters created by older driver versions have no applied fingerprint, so the secrets show which credentials are in use
+	if v.AppliedFingerprint == "" {
+		applied, err := isCredentialApplied(ctx, adminKi, managedKi, v)
+		if err != nil {
+			return nil, err
+		}
+		if applied {
+			v.AppliedFingerprint = v.Fingerprint
+			return nil, nil
+		}
+	}
+
+	rotation := &CredentialRotation{}
+	if err := createOrUpdateCAPISecret(ctx, v, adminKi); err != nil {
+		return rotation, fmt.Errorf("failed to update CAPI credentials: %v", err)
+	}
+	rotation.Updated = append(rotation.Updated, fmt.Sprintf("secret %s/%s", v.CAPIOCINamespace, v.CAPICredentialName))
+	restarted, err := restartDeployment(ctx, adminKi, v.CAPIOCINamespace, capociControllerManager)
+	if err != nil {
+		return rotation, err
+	}
+	if restarted {
+		rotation.Updated = append(rotation.Updated, fmt.Sprintf("deployment %s/%s", v.CAPIOCINamespace, capociControllerManager))
+	}
+
+	if v.InstallCCM {
+		for _, secret := range credentialSecrets {
+			if _, err := createOrUpdateObject(ctx, managedDi, object.Object{Text: secret.text}, v); err != nil {
+				return rotation, fmt.Errorf("failed to update secret %s: %v", secret.name, err)
+			}
+			rotation.Updated = append(rotation.Updated, fmt.Sprintf("secret %s/%s", kubeSystemNamespace, secret.name))
+		}
+		for _, consumer := range []struct {
+			kind    string
+			name    string
+			restart func(context.Context, kubernetes.Interface, string, string) (bool, error)
+		}{
+			{"daemonset", ccmDaemonSet, restartDaemonSet},
+			{"deployment", csiControllerDeployment, restartDeployment},
+			{"daemonset", csiNodeDaemonSet, restartDaemonSet},
+		} {
+			restarted, err := consumer.restart(ctx, managedKi, kubeSystemNamespace, consumer.name)
+			if err != nil {
+				return rotation, err
+			}
+			if restarted {
+				rotation.Updated = append(rotation.Updated, fmt.Sprintf("%s %s/%s", consumer.kind, kubeSystemNamespace, consumer.name))
+			}
+		}
+	}
+
+	v.AppliedFingerprint = v.Fingerprint
+	return rotation, nil
+}
+
+// isCredentialApplied is true if the CAPI secret and the managed cluster CCM and CSI secrets have the cloud credential's API key
+func isCredentialApplied(ctx context.Context, adminKi, managedKi kubernetes.Interface, v *variables.Variables) (bool, error) {
+	capiSecret, err := adminKi.CoreV1().Secrets(v.CAPIOCINamespace).Get(ctx, v.CAPICredentialName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get CAPI credentials: %v", err)
+	}
+	if string(capiSecret.Data[ociFingerprintField]) != v.Fingerprint {
+		return false, nil
+	}
+	if !v.InstallCCM {
+		return true, nil
+	}
+	for _, credentialSecret := range credentialSecrets {
+		secret, err := managedKi.CoreV1().Secrets(kubeSystemNamespace).Get(ctx, credentialSecret.name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to get secret %s/%s: %v", kubeSystemNamespace, credentialSecret.name, err)
+		}
+		config := struct {
+			Auth struct {
+				Fingerprint string `yaml:"fingerprint"`
+			} `yaml:"auth"`
+		}{}
+		if err := yaml.Unmarshal(secret.Data[credentialSecret.key], &config); err != nil || config.Auth.Fingerprint != v.Fingerprint {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// restartPatch rolls the pods of a workload, the same way as kubectl rollout restart
+func restartPatch() []byte {
+	return []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{"%s":"%s"}}}}}`, restartedAtAnnotation, time.Now().Format(time.RFC3339)))
+}
+
+// restartDeployment restarts a Deployment, returning false if it does not exist
+func restartDeployment(ctx context.Context, ki kubernetes.Interface, namespace, name string) (bool, error) {
+	_, err := ki.AppsV1().Deployments(namespace).Patch(ctx, name, k8stypes.StrategicMergePatchType, restartPatch(), metav1.PatchOptions{})
+	return restartResult(err, "deployment", namespace, name)
+}
+
+// restartDaemonSet restarts a DaemonSet, returning false if it does not exist
+func restartDaemonSet(ctx context.Context, ki kubernetes.Interface, namespace, name string) (bool, error) {
+	_, err := ki.AppsV1().DaemonSets(namespace).Patch(ctx, name, k8stypes.StrategicMergePatchType, restartPatch(), metav1.PatchOptions{})
+	return restartResult(err, "daemonset", namespace, name)
+}
+
+func restartResult(err error, kind, namespace, name string) (bool, error) {
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to restart %s %s/%s: %v", kind, namespace, name, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package capi
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/variables"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fake2 "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+func TestRotateCredentials(t *testing.T) {
+	ctx := context.TODO()
+	rotated := func(applied, fingerprint, authMode string) *variables.Variables {
+		v := *testVariables
+		v.CAPICredentialName = "creds"
+		v.CAPIOCINamespace = variables.CAPIOCINamespace
+		v.AuthMode = authMode
+		v.AppliedFingerprint = applied
+		v.Fingerprint = fingerprint
+		return &v
+	}
+	allUpdated := []string{
+		"secret verrazzano-capi/creds",
+		"deployment verrazzano-capi/capoci-controller-manager",
+		"secret kube-system/oci-cloud-controller-manager",
+		"secret kube-system/oci-volume-provisioner",
+		"daemonset kube-system/oci-cloud-controller-manager",
+		"deployment kube-system/csi-oci-controller",
+	}
+	var tests = []struct {
+		name string
+		v    *variables.Variables
+		// secretFingerprint is the fingerprint already in the CAPI, CCM and CSI secrets
+		secretFingerprint string
+		updated           []string
+		fingerprint       string
+	}{
+		{
+			"instance principal has no credentials",
+			rotated("", "", variables.AuthModeInstancePrincipal),
+			"",
+			nil,
+			"",
+		},
+		{
+			"credentials not rotated",
+			rotated("aa", "aa", variables.AuthModeUserPrincipal),
+			"aa",
+			nil,
+			"aa",
+		},
+		{
+			"first fingerprint is recorded",
+			rotated("", "aa", variables.AuthModeUserPrincipal),
+			"aa",
+			nil,
+			"aa",
+		},
+		{
+			"credentials rotated before the fingerprint was recorded",
+			rotated("", "bb", variables.AuthModeUserPrincipal),
+			"aa",
+			allUpdated,
+			"bb",
+		},
+		{
+			"credentials rotated",
+			rotated("aa", "bb", variables.AuthModeUserPrincipal),
+			"aa",
+			allUpdated,
+			"bb",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adminKi := fake.NewSimpleClientset(&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: capociControllerManager, Namespace: variables.CAPIOCINamespace},
+			}, &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: variables.CAPIOCINamespace},
+				Data:       map[string][]byte{ociFingerprintField: []byte(tt.secretFingerprint)},
+			})
+			// the CSI node DaemonSet is not installed
+			managedKi := fake.NewSimpleClientset(&appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Name: ccmDaemonSet, Namespace: kubeSystemNamespace},
+			}, &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: csiControllerDeployment, Namespace: kubeSystemNamespace},
+			})
+			for _, secret := range credentialSecrets {
+				_, err := managedKi.CoreV1().Secrets(kubeSystemNamespace).Create(ctx, &v1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: secret.name, Namespace: kubeSystemNamespace},
+					Data:       map[string][]byte{secret.key: []byte(fmt.Sprintf("auth:\n  region: r\n  fingerprint: %s\n", tt.secretFingerprint))},
+				}, metav1.CreateOptions{})
+				assert.NoError(t, err)
+			}
+			managedDi := fake2.NewSimpleDynamicClient(runtime.NewScheme())
+
+			rotation, err := testCAPIClient.RotateCredentials(ctx, adminKi, managedKi, managedDi, tt.v)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.fingerprint, tt.v.AppliedFingerprint)
+			if tt.updated == nil {
+				assert.Nil(t, rotation)
+				return
+			}
+			assert.Equal(t, tt.updated, rotation.Updated)
+
+			ds, err := managedKi.AppsV1().DaemonSets(kubeSystemNamespace).Get(ctx, ccmDaemonSet, metav1.GetOptions{})
+			assert.NoError(t, err)
+			assert.NotEmpty(t, ds.Spec.Template.Annotations[restartedAtAnnotation])
+			secret, err := adminKi.CoreV1().Secrets(variables.CAPIOCINamespace).Get(ctx, "creds", metav1.GetOptions{})
+			assert.NoError(t, err)
+			assert.Equal(t, "bb", string(secret.Data[ociFingerprintField]))
+		})
+	}
+}
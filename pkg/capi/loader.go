@@ -11,6 +11,7 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	apiyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"strconv"
 	"strings"
 	"text/template"
 )
@@ -33,6 +34,7 @@ func toObjects(yamlDocuments []string) []object.Object {
 func loadTextTemplate(o object.Object, variables variables.Variables) ([]unstructured.Unstructured, error) {
 	t, err := template.New("objectText").Funcs(template.FuncMap{
 		"contains": strings.Contains,
+		"quote":    strconv.Quote,
 		"nindent": func(indent int, s string) string {
 			spacing := strings.Repeat(" ", indent)
 			split := strings.FieldsFunc(s, func(r rune) bool {
@@ -0,0 +1,135 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package capi
+
+import (
+	"context"
+	"fmt"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/gvr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"time"
+)
+
+const (
+	// machineProvisioningTimeout is how long a Machine may provision before it is considered stuck
+	machineProvisioningTimeout = 30 * time.Minute
+
+	machinePhaseFailed         = "Failed"
+	machinePhaseDeleting       = "Deleting"
+	machinePhaseDeleted        = "Deleted"
+	machineDeploymentNameLabel = "cluster.x-k8s.io/deployment-name"
+	controlPlaneNameLabel      = "cluster.x-k8s.io/control-plane-name"
+	conditionSeverityError     = "Error"
+)
+
+// MachineFailure is a Machine that failed to launch, or is stuck provisioning
+type MachineFailure struct {
+	Machine string
+	// NodePool is the node pool of the Machine, or empty for control plane Machines
+	NodePool string
+	Reason   string
+	Message  string
+	// Stuck is true if the Machine reported no failure, but did not finish provisioning in time
+	Stuck bool
+}
+
+func (f MachineFailure) String() string {
+	location := "the control plane"
+	if f.NodePool != "" {
+		location = fmt.Sprintf("node pool %s", f.NodePool)
+	}
+	detail := "no error reported"
+	if f.Reason != "" && f.Message != "" {
+		detail = fmt.Sprintf("%s: %s", f.Reason, f.Message)
+	} else if f.Reason != "" || f.Message != "" {
+		detail = f.Reason + f.Message
+	}
+	if f.Stuck {
+		return fmt.Sprintf("machine %s in %s has been provisioning for more than %s, %s", f.Machine, location, machineProvisioningTimeout, detail)
+	}
+	return fmt.Sprintf("machine %s in %s failed, %s", f.Machine, location, detail)
+}
+
+// machineFailure checks a Machine and its OCIMachine for a terminal failure, or provisioning that is stuck
+func machineFailure(ctx context.Context, di dynamic.Interface, machine *unstructured.Unstructured) (*MachineFailure, error) {
+	phase, _, _ := unstructured.NestedString(machine.Object, "status", "phase")
+	switch phase {
+	case machinePhaseRunning, machinePhaseDeleting, machinePhaseDeleted:
+		return nil, nil
+	}
+	failure := &MachineFailure{
+		Machine: machine.GetName(),
+	}
+	if _, isControlPlane := machine.GetLabels()[controlPlaneNameLabel]; !isControlPlane {
+		failure.NodePool = machine.GetLabels()[machineDeploymentNameLabel]
+	}
+
+	ociMachine, err := getOCIMachine(ctx, di, machine)
+	if err != nil {
+		return nil, err
+	}
+	// the OCIMachine has the OCI error, so it is checked before the Machine
+	for _, u := range []*unstructured.Unstructured{ociMachine, machine} {
+		if u == nil {
+			continue
+		}
+		failure.Reason, _, _ = unstructured.NestedString(u.Object, "status", "failureReason")
+		failure.Message, _, _ = unstructured.NestedString(u.Object, "status", "failureMessage")
+		if failure.Reason == "" && failure.Message == "" {
+			failure.Reason, failure.Message = errorCondition(u)
+		}
+		if failure.Reason != "" || failure.Message != "" {
+			return failure, nil
+		}
+	}
+	if phase == machinePhaseFailed {
+		return failure, nil
+	}
+
+	created := machine.GetCreationTimestamp()
+	if created.IsZero() || time.Since(created.Time) < machineProvisioningTimeout {
+		return nil, nil
+	}
+	failure.Stuck = true
+	for _, u := range []*unstructured.Unstructured{ociMachine, machine} {
+		if u != nil && failure.Reason == "" && failure.Message == "" {
+			failure.Reason, failure.Message = conditionDetail(u, readyCondition)
+		}
+	}
+	return failure, nil
+}
+
+// getOCIMachine gets the infrastructure of a Machine, if it has been created
+func getOCIMachine(ctx context.Context, di dynamic.Interface, machine *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	name, _, _ := unstructured.NestedString(machine.Object, "spec", "infrastructureRef", "name")
+	if name == "" {
+		return nil, nil
+	}
+	ociMachine, err := di.Resource(gvr.OCIMachine).Namespace(machine.GetNamespace()).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get OCIMachine for machine %s: %v", machine.GetName(), err)
+	}
+	return ociMachine, nil
+}
+
+// errorCondition is the reason and message of the first false condition with Error severity
+func errorCondition(u *unstructured.Unstructured) (string, string) {
+	conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+	for _, c := range conditions {
+		cMap, ok := c.(map[string]interface{})
+		if !ok || cMap["status"] != string(metav1.ConditionFalse) || cMap["severity"] != conditionSeverityError {
+			continue
+		}
+		reason, _ := cMap["reason"].(string)
+		message, _ := cMap["message"].(string)
+		return reason, message
+	}
+	return "", ""
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package capi
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/gvr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fake2 "k8s.io/client-go/dynamic/fake"
+	"testing"
+	"time"
+)
+
+func createTestWorkerMachine(phase string, age time.Duration) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(gvr.Machine.GroupVersion().String())
+	u.SetKind("Machine")
+	u.SetName("np-1-abcde")
+	u.SetNamespace(testName)
+	u.SetLabels(map[string]string{
+		"cluster.x-k8s.io/cluster-name": testName,
+		machineDeploymentNameLabel:      "np-1",
+	})
+	u.SetCreationTimestamp(metav1.NewTime(time.Now().Add(-age)))
+	_ = unstructured.SetNestedField(u.Object, "np-1-abcde", "spec", "infrastructureRef", "name")
+	_ = unstructured.SetNestedField(u.Object, phase, "status", "phase")
+	return u
+}
+
+func createTestOCIMachine(conditions ...map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(gvr.OCIMachine.GroupVersion().String())
+	u.SetKind("OCIMachine")
+	u.SetName("np-1-abcde")
+	u.SetNamespace(testName)
+	return withConditions(u, conditions...)
+}
+
+func TestMachineFailure(t *testing.T) {
+	failed := createTestWorkerMachine(machinePhaseFailed, time.Minute)
+	_ = unstructured.SetNestedField(failed.Object, "CreateError", "status", "failureReason")
+	_ = unstructured.SetNestedField(failed.Object, "image not found", "status", "failureMessage")
+	controlPlane := createTestWorkerMachine("Provisioning", time.Hour)
+	controlPlane.SetLabels(map[string]string{
+		controlPlaneNameLabel: testName,
+	})
+	capacityError := testCondition("InstanceReady", "False", "InstanceProvisionFailed", "Out of host capacity")
+	capacityError["severity"] = conditionSeverityError
+
+	var tests = []struct {
+		name    string
+		machine *unstructured.Unstructured
+		objects []runtime.Object
+		failure string
+	}{
+		{
+			"running",
+			createTestWorkerMachine(machinePhaseRunning, time.Hour),
+			nil,
+			"",
+		},
+		{
+			"provisioning",
+			createTestWorkerMachine("Provisioning", time.Minute),
+			[]runtime.Object{createTestOCIMachine(testCondition(readyCondition, "False", "InstanceNotReady", ""))},
+			"",
+		},
+		{
+			"machine failed",
+			failed,
+			nil,
+			"machine np-1-abcde in node pool np-1 failed, CreateError: image not found",
+		},
+		{
+			"OCI instance failed",
+			createTestWorkerMachine("Provisioning", time.Minute),
+			[]runtime.Object{createTestOCIMachine(capacityError)},
+			"machine np-1-abcde in node pool np-1 failed, InstanceProvisionFailed: Out of host capacity",
+		},
+		{
+			"stuck provisioning",
+			createTestWorkerMachine("Provisioning", time.Hour),
+			[]runtime.Object{createTestOCIMachine(testCondition(readyCondition, "False", "InstanceNotReady", "waiting for instance"))},
+			"machine np-1-abcde in node pool np-1 has been provisioning for more than 30m0s, InstanceNotReady: waiting for instance",
+		},
+		{
+			"control plane stuck provisioning",
+			controlPlane,
+			nil,
+			"machine np-1-abcde in the control plane has been provisioning for more than 30m0s, no error reported",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			di := fake2.NewSimpleDynamicClient(runtime.NewScheme(), tt.objects...)
+			failure, err := machineFailure(context.TODO(), di, tt.machine)
+			assert.NoError(t, err)
+			if tt.failure == "" {
+				assert.Nil(t, failure)
+			} else {
+				assert.NotNil(t, failure)
+				assert.Equal(t, tt.failure, failure.String())
+			}
+		})
+	}
+}
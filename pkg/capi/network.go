@@ -0,0 +1,58 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package capi
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const ociClusterKind = "OCICluster"
+
+// networkLists are the OCICluster lists of network resources, whose OCIDs are recorded by the OCI provider
+var networkLists = [][]string{
+	{"spec", "networkSpec", "vcn", "subnets"},
+	{"spec", "networkSpec", "vcn", "networkSecurityGroup", "list"},
+}
+
+// preserveNetworkIDs keeps the OCIDs of the existing OCICluster subnets and network security groups.
+// Updates replace these lists, so without the OCIDs the OCI provider would have to look the resources up again.
+func preserveNetworkIDs(existing, u *unstructured.Unstructured) error {
+	if u.GetKind() != ociClusterKind {
+		return nil
+	}
+	for _, fields := range networkLists {
+		existingItems, found, err := unstructured.NestedSlice(existing.Object, fields...)
+		if err != nil || !found {
+			continue
+		}
+		items, found, err := unstructured.NestedSlice(u.Object, fields...)
+		if err != nil || !found {
+			continue
+		}
+		ids := map[string]interface{}{}
+		for _, item := range existingItems {
+			if m, ok := item.(map[string]interface{}); ok && m["id"] != nil {
+				ids[networkItemKey(m)] = m["id"]
+			}
+		}
+		for _, item := range items {
+			m, ok := item.(map[string]interface{})
+			if !ok || m["id"] != nil {
+				continue
+			}
+			if id, ok := ids[networkItemKey(m)]; ok {
+				m["id"] = id
+			}
+		}
+		if err := unstructured.SetNestedSlice(u.Object, items, fields...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func networkItemKey(item map[string]interface{}) string {
+	return fmt.Sprintf("%v/%v", item["role"], item["name"])
+}
@@ -58,6 +58,9 @@ func Modules(v *variables.Variables) []Object {
 	if v.InstallCCM {
 		objects = append(objects, ccm...)
 	}
+	if v.InstallClusterAutoscaler {
+		objects = append(objects, clusterAutoscalerModule)
+	}
 
 	return objects
 }
@@ -67,6 +70,7 @@ func CreateObjects() []Object {
 		workers:      true,
 		controlplane: true,
 		capi:         true,
+		healthChecks: true,
 	})
 }
 
@@ -75,6 +79,7 @@ func UpdateObjects() []Object {
 		workers:      false,
 		controlplane: false,
 		capi:         true,
+		healthChecks: true,
 	})
 }
 
@@ -90,6 +95,9 @@ func objectList(i include) []Object {
 	if i.workers {
 		res = append(res, Workers...)
 	}
+	if i.healthChecks {
+		res = append(res, HealthChecks...)
+	}
 	return res
 }
 
@@ -102,6 +110,7 @@ type include struct {
 	workers      bool
 	controlplane bool
 	capi         bool
+	healthChecks bool
 }
 
 var ccm = []Object{
@@ -114,21 +123,29 @@ var cniModule = Object{
 	Text: templates.CalicoModule,
 }
 
+var clusterAutoscalerModule = Object{
+	Text: templates.ClusterAutoscalerModule,
+}
+
 var ControlPlane = []Object{
 	{Text: templates.OCNEControlPlane},
 	{Text: templates.OCIControlPlaneMachineTemplate},
 }
 
 var Workers = []Object{
-	{Text: templates.MachineDeployment},
+	{Text: templates.OCNEConfigTemplate},
 	{Text: templates.OCIMachineTemplate},
+	{Text: templates.MachineDeployment},
+}
+
+var HealthChecks = []Object{
+	{Text: templates.MachineHealthCheck},
 }
 
 var capi = []Object{
 	CAPICluster,
 	{Text: templates.ClusterIdentity},
 	{Text: templates.OCICluster},
-	{Text: templates.OCNEConfigTemplate},
 }
 
 var CAPICluster = Object{Text: templates.Cluster}
@@ -0,0 +1,376 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package capi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/capi/object"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/gvr"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/variables"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"strings"
+)
+
+// Phase is the lifecycle phase of a managed cluster
+type Phase string
+
+const (
+	PhaseProvisioning Phase = "Provisioning"
+	PhaseUpdating     Phase = "Updating"
+	PhaseReady        Phase = "Ready"
+	PhaseDeleting     Phase = "Deleting"
+	PhaseFailed       Phase = "Failed"
+)
+
+const (
+	clusterPhaseFailed   = "Failed"
+	clusterPhaseDeleting = "Deleting"
+	readyCondition       = "Ready"
+	verrazzanoStateReady = "Ready"
+)
+
+// ComponentStatus is the readiness of one part of the cluster
+type ComponentStatus struct {
+	Name    string
+	Ready   bool
+	Reason  string
+	Message string
+}
+
+func (c ComponentStatus) String() string {
+	s := c.Name
+	if c.Reason != "" && c.Message != "" {
+		s = fmt.Sprintf("%s (%s: %s)", s, c.Reason, c.Message)
+	} else if c.Reason != "" || c.Message != "" {
+		s = fmt.Sprintf("%s (%s%s)", s, c.Reason, c.Message)
+	}
+	return s
+}
+
+// ClusterStatus is the status of a managed cluster, derived from the conditions of its CAPI resources
+type ClusterStatus struct {
+	Phase Phase
+	// Reason is why the cluster failed, if the phase is PhaseFailed
+	Reason             string
+	Infrastructure     ComponentStatus
+	ControlPlane       ComponentStatus
+	MachineDeployments []ComponentStatus
+	Machines           ComponentStatus
+	// FailedMachines are the Machines that failed to launch, or are stuck provisioning
+	FailedMachines []MachineFailure
+	// Modules and Verrazzano are only set when the managed cluster status is loaded
+	Modules    []ComponentStatus
+	Verrazzano *ComponentStatus
+}
+
+// Components is every component of the cluster status
+func (s *ClusterStatus) Components() []ComponentStatus {
+	components := []ComponentStatus{s.Infrastructure, s.ControlPlane}
+	components = append(components, s.MachineDeployments...)
+	components = append(components, s.Machines)
+	components = append(components, s.Modules...)
+	if s.Verrazzano != nil {
+		components = append(components, *s.Verrazzano)
+	}
+	return components
+}
+
+// Ready is true if every component of the cluster is ready
+func (s *ClusterStatus) Ready() bool {
+	for _, component := range s.Components() {
+		if !component.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// Summary describes the cluster phase and what the cluster is waiting for
+func (s *ClusterStatus) Summary() string {
+	if s.Phase == PhaseFailed {
+		return fmt.Sprintf("%s: %s", s.Phase, s.Reason)
+	}
+	var waiting []string
+	for _, component := range s.Components() {
+		if !component.Ready {
+			waiting = append(waiting, component.String())
+		}
+	}
+	if len(waiting) < 1 {
+		return string(s.Phase)
+	}
+	return fmt.Sprintf("%s, waiting for %s", s.Phase, strings.Join(waiting, ", "))
+}
+
+// ProgressingError is returned while the cluster is converging. It is not a failure, and the operation should be retried.
+type ProgressingError struct {
+	Phase   Phase
+	Message string
+	// Status is the cluster status when the error was returned, if it was loaded
+	Status *ClusterStatus
+}
+
+func (e *ProgressingError) Error() string {
+	return e.Message
+}
+
+// IsProgressing is true if the error only reports that the cluster is still progressing
+func IsProgressing(err error) bool {
+	var progressing *ProgressingError
+	return errors.As(err, &progressing)
+}
+
+// GetClusterStatus loads the status of the cluster from the CAPI resources on the admin cluster
+func GetClusterStatus(ctx context.Context, di dynamic.Interface, v *variables.Variables) (*ClusterStatus, error) {
+	cluster, err := di.Resource(gvr.Cluster).Namespace(v.Namespace).Get(ctx, v.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	status := &ClusterStatus{
+		Infrastructure: ComponentStatus{
+			Name:  "infrastructure",
+			Ready: nestedBool(cluster, "status", "infrastructureReady"),
+		},
+	}
+	if !status.Infrastructure.Ready {
+		status.Infrastructure.Reason, status.Infrastructure.Message = conditionDetail(cluster, "InfrastructureReady")
+	}
+
+	status.ControlPlane, err = controlPlaneStatus(ctx, di, v, cluster)
+	if err != nil {
+		return nil, err
+	}
+	for _, np := range v.NodePools {
+		mdStatus, err := machineDeploymentStatus(ctx, di, v, np.Name)
+		if err != nil {
+			return nil, err
+		}
+		status.MachineDeployments = append(status.MachineDeployments, mdStatus)
+	}
+	status.Machines, status.FailedMachines, err = machinesStatus(ctx, di, v)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterPhase, _, _ := unstructured.NestedString(cluster.Object, "status", "phase")
+	switch {
+	case cluster.GetDeletionTimestamp() != nil || clusterPhase == clusterPhaseDeleting:
+		status.Phase = PhaseDeleting
+	case clusterPhase == clusterPhaseFailed:
+		status.Phase = PhaseFailed
+		failureReason, _, _ := unstructured.NestedString(cluster.Object, "status", "failureReason")
+		failureMessage, _, _ := unstructured.NestedString(cluster.Object, "status", "failureMessage")
+		status.Reason = strings.TrimPrefix(strings.Join([]string{failureReason, failureMessage}, ": "), ": ")
+	case len(status.FailedMachines) > 0:
+		status.Phase = PhaseFailed
+		var failures []string
+		for _, failure := range status.FailedMachines {
+			failures = append(failures, failure.String())
+		}
+		status.Reason = strings.Join(failures, "; ")
+	case clusterPhase != clusterPhaseProvisioned:
+		status.Phase = PhaseProvisioning
+	case status.Ready():
+		status.Phase = PhaseReady
+	default:
+		status.Phase = PhaseUpdating
+	}
+	return status, nil
+}
+
+// LoadManagedClusterStatus adds the status of the modules and Verrazzano on the managed cluster
+func (s *ClusterStatus) LoadManagedClusterStatus(ctx context.Context, managedDi dynamic.Interface, v *variables.Variables) error {
+	s.Modules = nil
+	for _, module := range object.Modules(v) {
+		us, err := loadTextTemplate(module, *v)
+		if err != nil {
+			return err
+		}
+		for _, u := range us {
+			if u.GetKind() != "Module" {
+				continue
+			}
+			moduleStatus, err := resourceStatus(ctx, managedDi, object.GVR(&u), u.GetNamespace(), u.GetName(), fmt.Sprintf("module %s", u.GetName()))
+			if err != nil {
+				return err
+			}
+			s.Modules = append(s.Modules, moduleStatus)
+		}
+	}
+
+	s.Verrazzano = nil
+	if v.InstallVerrazzano && v.VerrazzanoResource != "" {
+		us, err := loadTextTemplate(object.Object{Text: v.VerrazzanoResource}, *v)
+		if err != nil {
+			return err
+		}
+		if len(us) != 1 {
+			return fmt.Errorf("expected 1 Verrazzano resource from template, got %d", len(us))
+		}
+		vzStatus, err := resourceStatus(ctx, managedDi, gvr.Verrazzano, us[0].GetNamespace(), us[0].GetName(), "Verrazzano")
+		if err != nil {
+			return err
+		}
+		s.Verrazzano = &vzStatus
+	}
+	if s.Phase == PhaseReady && !s.Ready() {
+		s.Phase = PhaseUpdating
+	}
+	return nil
+}
+
+func controlPlaneStatus(ctx context.Context, di dynamic.Interface, v *variables.Variables, cluster *unstructured.Unstructured) (ComponentStatus, error) {
+	status := ComponentStatus{
+		Name:  "control plane",
+		Ready: nestedBool(cluster, "status", "controlPlaneReady"),
+	}
+	controlPlane, err := di.Resource(gvr.OCNEControlPlane).Namespace(v.Namespace).Get(ctx, fmt.Sprintf("%s-control-plane", v.Name), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			if !status.Ready {
+				status.Reason, status.Message = conditionDetail(cluster, "ControlPlaneReady")
+			}
+			return status, nil
+		}
+		return status, err
+	}
+	if status.Ready {
+		return status, nil
+	}
+	status.Reason, status.Message = conditionDetail(controlPlane, readyCondition)
+	if status.Message == "" {
+		replicas, _, _ := unstructured.NestedInt64(controlPlane.Object, "spec", "replicas")
+		readyReplicas, _, _ := unstructured.NestedInt64(controlPlane.Object, "status", "readyReplicas")
+		status.Message = fmt.Sprintf("%d/%d replicas ready", readyReplicas, replicas)
+	}
+	return status, nil
+}
+
+func machineDeploymentStatus(ctx context.Context, di dynamic.Interface, v *variables.Variables, name string) (ComponentStatus, error) {
+	status := ComponentStatus{
+		Name: fmt.Sprintf("machine deployment %s", name),
+	}
+	md, err := di.Resource(gvr.MachineDeployment).Namespace(v.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			status.Message = "not created"
+			return status, nil
+		}
+		return status, err
+	}
+	replicas, _, _ := unstructured.NestedInt64(md.Object, "spec", "replicas")
+	readyReplicas, _, _ := unstructured.NestedInt64(md.Object, "status", "readyReplicas")
+	updatedReplicas, _, _ := unstructured.NestedInt64(md.Object, "status", "updatedReplicas")
+	status.Ready = readyReplicas >= replicas && updatedReplicas >= replicas
+	if !status.Ready {
+		status.Reason, _ = conditionDetail(md, readyCondition)
+		status.Message = fmt.Sprintf("%d/%d replicas ready, %d/%d replicas updated", readyReplicas, replicas, updatedReplicas, replicas)
+	}
+	return status, nil
+}
+
+func machinesStatus(ctx context.Context, di dynamic.Interface, v *variables.Variables) (ComponentStatus, []MachineFailure, error) {
+	status := ComponentStatus{
+		Name: "nodes",
+	}
+	machineList, err := di.Resource(gvr.Machine).List(ctx, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(&metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"cluster.x-k8s.io/cluster-name": v.Name,
+			},
+		}),
+	})
+	if err != nil {
+		return status, nil, err
+	}
+	running := 0
+	var failures []MachineFailure
+	for i := range machineList.Items {
+		machine := &machineList.Items[i]
+		phase, _, _ := unstructured.NestedString(machine.Object, "status", "phase")
+		if phase == machinePhaseRunning {
+			running++
+			continue
+		}
+		failure, err := machineFailure(ctx, di, machine)
+		if err != nil {
+			return status, nil, err
+		}
+		if failure != nil {
+			failures = append(failures, *failure)
+		}
+	}
+	status.Ready = len(machineList.Items) > 0 && running == len(machineList.Items)
+	if !status.Ready {
+		status.Message = fmt.Sprintf("%d/%d machines running", running, len(machineList.Items))
+	}
+	return status, failures, nil
+}
+
+// resourceStatus is the status of a resource with a Ready condition or a Ready state, like a Module or a Verrazzano resource
+func resourceStatus(ctx context.Context, di dynamic.Interface, resource schema.GroupVersionResource, namespace, name, componentName string) (ComponentStatus, error) {
+	status := ComponentStatus{
+		Name: componentName,
+	}
+	u, err := di.Resource(resource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			status.Message = "not created"
+			return status, nil
+		}
+		return status, err
+	}
+	if state, _, _ := unstructured.NestedString(u.Object, "status", "state"); state != "" {
+		status.Ready = state == verrazzanoStateReady
+		if !status.Ready {
+			status.Reason = state
+		}
+		return status, nil
+	}
+	status.Ready = conditionTrue(u, readyCondition)
+	if !status.Ready {
+		status.Reason, status.Message = conditionDetail(u, readyCondition)
+	}
+	return status, nil
+}
+
+func nestedBool(u *unstructured.Unstructured, fields ...string) bool {
+	b, _, _ := unstructured.NestedBool(u.Object, fields...)
+	return b
+}
+
+// condition finds a status condition of a resource
+func condition(u *unstructured.Unstructured, conditionType string) map[string]interface{} {
+	conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+	for _, c := range conditions {
+		cMap, ok := c.(map[string]interface{})
+		if ok && cMap["type"] == conditionType {
+			return cMap
+		}
+	}
+	return nil
+}
+
+func conditionTrue(u *unstructured.Unstructured, conditionType string) bool {
+	c := condition(u, conditionType)
+	return c != nil && c["status"] == string(metav1.ConditionTrue)
+}
+
+// conditionDetail is the reason and message of a status condition, if the condition is present
+func conditionDetail(u *unstructured.Unstructured, conditionType string) (string, string) {
+	c := condition(u, conditionType)
+	if c == nil {
+		return "", ""
+	}
+	reason, _ := c["reason"].(string)
+	message, _ := c["message"].(string)
+	return reason, message
+}
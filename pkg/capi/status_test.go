@@ -0,0 +1,182 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package capi
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/gvr"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/variables"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fake2 "k8s.io/client-go/dynamic/fake"
+	"testing"
+	"time"
+)
+
+const testVerrazzano = `apiVersion: install.verrazzano.io/v1beta1
+kind: Verrazzano
+metadata:
+  name: verrazzano
+  namespace: default`
+
+func createTestMachineDeployment(name string, replicas, readyReplicas int64) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(gvr.MachineDeployment.GroupVersion().String())
+	u.SetKind("MachineDeployment")
+	u.SetName(name)
+	u.SetNamespace(testName)
+	_ = unstructured.SetNestedField(u.Object, replicas, "spec", "replicas")
+	_ = unstructured.SetNestedField(u.Object, readyReplicas, "status", "readyReplicas")
+	_ = unstructured.SetNestedField(u.Object, readyReplicas, "status", "updatedReplicas")
+	return u
+}
+
+func withConditions(u *unstructured.Unstructured, conditions ...map[string]interface{}) *unstructured.Unstructured {
+	var c []interface{}
+	for _, condition := range conditions {
+		c = append(c, condition)
+	}
+	_ = unstructured.SetNestedSlice(u.Object, c, "status", "conditions")
+	return u
+}
+
+func testCondition(conditionType, status, reason, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":    conditionType,
+		"status":  status,
+		"reason":  reason,
+		"message": message,
+	}
+}
+
+func TestGetClusterStatus(t *testing.T) {
+	v := *testVariables
+	v.NodePools = []variables.NodePool{{Name: "np-1"}}
+	failed := createTestCluster(&v, false, false, clusterPhaseFailed)
+	_ = unstructured.SetNestedField(failed.Object, "InvalidConfiguration", "status", "failureReason")
+	_ = unstructured.SetNestedField(failed.Object, "subnet not found", "status", "failureMessage")
+
+	failedMachine := createTestWorkerMachine(machinePhaseFailed, time.Minute)
+	_ = unstructured.SetNestedField(failedMachine.Object, "CreateError", "status", "failureReason")
+	_ = unstructured.SetNestedField(failedMachine.Object, "image not found", "status", "failureMessage")
+
+	var tests = []struct {
+		name    string
+		objects []runtime.Object
+		phase   Phase
+		summary string
+	}{
+		{
+			"ready",
+			[]runtime.Object{
+				createTestCluster(&v, true, true, clusterPhaseProvisioned),
+				createTestMachine(&v, machinePhaseRunning),
+				createTestMachineDeployment("np-1", 1, 1),
+			},
+			PhaseReady,
+			"Ready",
+		},
+		{
+			"provisioning",
+			[]runtime.Object{
+				withConditions(createTestCluster(&v, false, false, "Provisioning"),
+					testCondition("InfrastructureReady", "False", "WaitingForLoadBalancer", "creating load balancer"),
+				),
+			},
+			PhaseProvisioning,
+			"Provisioning, waiting for infrastructure (WaitingForLoadBalancer: creating load balancer), control plane, machine deployment np-1 (not created), nodes (0/0 machines running)",
+		},
+		{
+			"machine deployment scaling",
+			[]runtime.Object{
+				createTestCluster(&v, true, true, clusterPhaseProvisioned),
+				createTestMachine(&v, machinePhaseRunning),
+				createTestMachine(&v, "Provisioning"),
+				createTestMachineDeployment("np-1", 2, 1),
+			},
+			PhaseUpdating,
+			"Updating, waiting for machine deployment np-1 (1/2 replicas ready, 1/2 replicas updated), nodes (1/2 machines running)",
+		},
+		{
+			"machine failed",
+			[]runtime.Object{
+				createTestCluster(&v, true, true, clusterPhaseProvisioned),
+				createTestMachine(&v, machinePhaseRunning),
+				failedMachine,
+				createTestMachineDeployment("np-1", 1, 0),
+			},
+			PhaseFailed,
+			"Failed: machine np-1-abcde in node pool np-1 failed, CreateError: image not found",
+		},
+		{
+			"failed",
+			[]runtime.Object{failed},
+			PhaseFailed,
+			"Failed: InvalidConfiguration: subnet not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			di := fake2.NewSimpleDynamicClient(createTestScheme(), tt.objects...)
+			status, err := GetClusterStatus(context.TODO(), di, &v)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.phase, status.Phase)
+			assert.Equal(t, tt.summary, status.Summary())
+
+			err = IsCAPIClusterReady(context.TODO(), di, &v)
+			switch tt.phase {
+			case PhaseReady:
+				assert.NoError(t, err)
+			case PhaseFailed:
+				assert.Error(t, err)
+				assert.False(t, IsProgressing(err))
+			default:
+				assert.True(t, IsProgressing(err))
+				assert.Equal(t, tt.summary, err.Error())
+			}
+		})
+	}
+}
+
+func TestLoadManagedClusterStatus(t *testing.T) {
+	v := *testVariables
+	v.InstallCalico = true
+	v.InstallCCM = false
+	v.VerrazzanoResource = testVerrazzano
+
+	calico := &unstructured.Unstructured{}
+	calico.SetAPIVersion("platform.verrazzano.io/v1alpha1")
+	calico.SetKind("Module")
+	calico.SetName("calico")
+	calico.SetNamespace("default")
+	withConditions(calico, testCondition(readyCondition, "True", "", ""))
+	vz := &unstructured.Unstructured{}
+	vz.SetAPIVersion(gvr.Verrazzano.GroupVersion().String())
+	vz.SetKind("Verrazzano")
+	vz.SetName("verrazzano")
+	vz.SetNamespace("default")
+	_ = unstructured.SetNestedField(vz.Object, "Reconciling", "status", "state")
+
+	status := &ClusterStatus{
+		Phase:          PhaseReady,
+		Infrastructure: ComponentStatus{Name: "infrastructure", Ready: true},
+		ControlPlane:   ComponentStatus{Name: "control plane", Ready: true},
+		Machines:       ComponentStatus{Name: "nodes", Ready: true},
+	}
+	di := fake2.NewSimpleDynamicClient(runtime.NewScheme(), calico, vz)
+	assert.NoError(t, status.LoadManagedClusterStatus(context.TODO(), di, &v))
+	assert.Equal(t, []ComponentStatus{{Name: "module calico", Ready: true}}, status.Modules)
+	assert.Equal(t, PhaseUpdating, status.Phase)
+	assert.Equal(t, "Updating, waiting for Verrazzano (Reconciling)", status.Summary())
+}
+
+func TestProgressingError(t *testing.T) {
+	err := fmt.Errorf("cannot upgrade: %w", &ProgressingError{Phase: PhaseUpdating, Message: "waiting"})
+	assert.True(t, IsProgressing(err))
+	assert.False(t, IsProgressing(fmt.Errorf("waiting")))
+	assert.False(t, IsProgressing(nil))
+}
@@ -13,11 +13,16 @@ import (
 )
 
 // UpdateCluster upgrades the CAPI cluster by going through the following stages:
-// 1. update the CAPI credentials using the cloud credential. This keeps the cloud credential up-to-date
-// 2. update the control plane, and then wait for the control plane to be ready
-// 3. update the worker nodes, and then wait for the worker nodes to be ready
-// 4. update the remaining cluster resources, and then wait for the cluster to be ready
+// 1. check the cluster can be upgraded, if the Kubernetes version is changing
+// 2. update the CAPI credentials using the cloud credential. This keeps the cloud credential up-to-date
+// 3. update the control plane, and then wait for the control plane to be ready
+// 4. update the worker nodes, and then wait for the worker nodes to be ready
+// 5. update the remaining cluster resources, and then wait for the cluster to be ready
 func (c *CAPIClient) UpdateCluster(ctx context.Context, ki kubernetes.Interface, di dynamic.Interface, v *variables.Variables) error {
+	if err := checkUpgrade(ctx, ki, di, v); err != nil {
+		return err
+	}
+
 	// update the CAPI credentials if necessary
 	if err := createOrUpdateCAPISecret(ctx, v, ki); err != nil {
 		return fmt.Errorf("failed to create CAPI credentials: %v", err)
@@ -6,6 +6,14 @@ package capi
 import (
 	"context"
 	"github.com/stretchr/testify/assert"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/capi/object"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/gvr"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/templates"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/variables"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fake2 "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/fake"
 	"testing"
 )
@@ -16,3 +24,152 @@ func TestUpdateCluster(t *testing.T) {
 	err := testCAPIClient.UpdateCluster(context.TODO(), ki, di, testVariables)
 	assert.NoError(t, err)
 }
+
+func TestDeleteOrphanedTemplates(t *testing.T) {
+	ctx := context.TODO()
+	v := *testVariables
+	v.NodePools = []variables.NodePool{
+		{Name: "np-1", Hash: "abcde"},
+	}
+	template := func(resource schema.GroupVersionResource, kind, name, nodePool string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion(resource.GroupVersion().String())
+		u.SetKind(kind)
+		u.SetName(name)
+		u.SetNamespace(v.Namespace)
+		if nodePool != "" {
+			u.SetLabels(map[string]string{
+				nodePoolLabel: nodePool,
+			})
+		}
+		return u
+	}
+	machineTemplate := func(name, nodePool string) *unstructured.Unstructured {
+		return template(gvr.OCIMachineTemplate, "OCIMachineTemplate", name, nodePool)
+	}
+	configTemplate := func(name, nodePool string) *unstructured.Unstructured {
+		return template(gvr.OCNEConfigTemplate, "OCNEConfigTemplate", name, nodePool)
+	}
+	di := createTestDIWithClusterAndMachine(
+		machineTemplate("np-1-abcde", "np-1"),
+		machineTemplate("np-1-fghij", "np-1"),
+		machineTemplate("np-2-abcde", "np-2"),
+		machineTemplate("test-abcde-control-plane", ""),
+		configTemplate("np-1-abcde", "np-1"),
+		configTemplate("np-1-fghij", "np-1"),
+		configTemplate(v.Name, ""),
+	)
+
+	assert.NoError(t, testCAPIClient.DeleteHangingResources(ctx, di, &v))
+	names := func(resource schema.GroupVersionResource) []string {
+		templates, err := di.Resource(resource).Namespace(v.Namespace).List(ctx, metav1.ListOptions{})
+		assert.NoError(t, err)
+		var names []string
+		for _, template := range templates.Items {
+			names = append(names, template.GetName())
+		}
+		return names
+	}
+	assert.ElementsMatch(t, []string{"np-1-abcde", "test-abcde-control-plane"}, names(gvr.OCIMachineTemplate))
+	assert.ElementsMatch(t, []string{"np-1-abcde"}, names(gvr.OCNEConfigTemplate))
+}
+
+func TestDeleteOrphanedMachineHealthChecks(t *testing.T) {
+	ctx := context.TODO()
+	v := *testVariables
+	v.NodePools = []variables.NodePool{
+		{Name: "np-1", MachineHealthCheck: &variables.MachineHealthCheck{}},
+		{Name: "np-2"},
+	}
+	mhc := func(name, label string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion(gvr.MachineHealthCheck.GroupVersion().String())
+		u.SetKind("MachineHealthCheck")
+		u.SetName(name)
+		u.SetNamespace(v.Namespace)
+		if label != "" {
+			u.SetLabels(map[string]string{
+				machineHealthCheckLabel: label,
+			})
+		}
+		return u
+	}
+	di := createTestDIWithClusterAndMachine(
+		mhc("test-control-plane", "control-plane"),
+		mhc("np-1", "np-1"),
+		mhc("np-2", "np-2"),
+		mhc("np-3", "np-3"),
+		mhc("user-managed", ""),
+	)
+
+	assert.NoError(t, testCAPIClient.DeleteHangingResources(ctx, di, &v))
+	mhcs, err := di.Resource(gvr.MachineHealthCheck).Namespace(v.Namespace).List(ctx, metav1.ListOptions{})
+	assert.NoError(t, err)
+	var names []string
+	for _, u := range mhcs.Items {
+		names = append(names, u.GetName())
+	}
+	assert.ElementsMatch(t, []string{"np-1", "user-managed"}, names)
+}
+
+func TestUpdateAllowLists(t *testing.T) {
+	ctx := context.TODO()
+	v := *testVariables
+	v.QuickCreateVCN = true
+	v.ClusterCIDR = "10.96.0.0/16"
+	di := fake2.NewSimpleDynamicClient(createTestScheme())
+	ociCluster := object.Object{Text: templates.OCICluster}
+	rendered, err := loadTextTemplate(ociCluster, v)
+	assert.NoError(t, err)
+	resource := object.GVR(&rendered[0])
+	_, err = createOrUpdateObject(ctx, di, ociCluster, &v)
+	assert.NoError(t, err)
+
+	// the OCI provider records the OCIDs of the network resources
+	u, err := di.Resource(resource).Namespace(v.Namespace).Get(ctx, v.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, unstructured.SetNestedField(u.Object, "ocid1.vcn", "spec", "networkSpec", "vcn", "id"))
+	for _, fields := range networkLists {
+		items, _, err := unstructured.NestedSlice(u.Object, fields...)
+		assert.NoError(t, err)
+		for _, item := range items {
+			m := item.(map[string]interface{})
+			m["id"] = "ocid1." + m["name"].(string)
+		}
+		assert.NoError(t, unstructured.SetNestedSlice(u.Object, items, fields...))
+	}
+	_, err = di.Resource(resource).Namespace(v.Namespace).Update(ctx, u, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	v.APIServerAllowedCIDRs = []string{"203.0.113.0/24"}
+	v.SSHAllowedCIDRs = []string{variables.SSHDisabled}
+	_, err = createOrUpdateObject(ctx, di, ociCluster, &v)
+	assert.NoError(t, err)
+	u, err = di.Resource(resource).Namespace(v.Namespace).Get(ctx, v.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	vcnID, _, _ := unstructured.NestedString(u.Object, "spec", "networkSpec", "vcn", "id")
+	assert.Equal(t, "ocid1.vcn", vcnID)
+	for _, fields := range networkLists {
+		items, _, err := unstructured.NestedSlice(u.Object, fields...)
+		assert.NoError(t, err)
+		assert.Len(t, items, 4)
+		for _, item := range items {
+			m := item.(map[string]interface{})
+			assert.Equal(t, "ocid1."+m["name"].(string), m["id"])
+		}
+	}
+	nsgs, _, _ := unstructured.NestedSlice(u.Object, "spec", "networkSpec", "vcn", "networkSecurityGroup", "list")
+	for _, nsg := range nsgs {
+		rules := nsg.(map[string]interface{})["ingressRules"].([]interface{})
+		for _, rule := range rules {
+			ingress := rule.(map[string]interface{})["ingressRule"].(map[string]interface{})
+			switch ingress["description"] {
+			case "External access to Kubernetes API endpoint":
+				assert.Equal(t, "203.0.113.0/24", ingress["source"])
+			case "Inbound SSH traffic to Control Plane", "Inbound SSH traffic to worker node":
+				assert.Fail(t, "SSH is disabled", ingress["source"])
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package capi
+
+import (
+	"context"
+	"fmt"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/capi/object"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/gvr"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/variables"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/version"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"strings"
+)
+
+// CheckUpgrade runs the pre-flight checks before the Kubernetes version of the cluster is changed
+func (c *CAPIClient) CheckUpgrade(ctx context.Context, ki kubernetes.Interface, di dynamic.Interface, v *variables.Variables) error {
+	return checkUpgrade(ctx, ki, di, v)
+}
+
+// checkUpgrade runs the pre-flight checks before the Kubernetes version of the cluster is changed.
+// If the cluster is already at the requested version, or the cluster has no control plane yet, there is nothing to check.
+func checkUpgrade(ctx context.Context, ki kubernetes.Interface, di dynamic.Interface, v *variables.Variables) error {
+	current, err := deployedKubernetesVersion(ctx, di, v)
+	if err != nil {
+		return err
+	}
+	if current == "" || current == v.KubernetesVersion {
+		return nil
+	}
+	if err := checkVersionSkew(current, v.KubernetesVersion); err != nil {
+		return err
+	}
+
+	defaults, err := version.GetDefaults(ctx, ki, v.KubernetesVersion)
+	if err != nil {
+		return fmt.Errorf("failed to load OCNE version mapping: %v", err)
+	}
+	if defaults == nil {
+		return fmt.Errorf("cannot upgrade to Kubernetes %s, the version is not in the OCNE version mapping", v.KubernetesVersion)
+	}
+	if !v.AllowCustomImageTags {
+		if err := checkImageTags(v, defaults); err != nil {
+			return err
+		}
+	}
+
+	if err := IsCAPIClusterReady(ctx, di, v); err != nil {
+		return fmt.Errorf("cannot upgrade to Kubernetes %s, the cluster is not ready: %w", v.KubernetesVersion, err)
+	}
+	return nil
+}
+
+// deployedKubernetesVersion is the Kubernetes version of the cluster control plane
+func deployedKubernetesVersion(ctx context.Context, di dynamic.Interface, v *variables.Variables) (string, error) {
+	controlPlane, err := di.Resource(gvr.OCNEControlPlane).Namespace(v.Namespace).Get(ctx, fmt.Sprintf("%s-control-plane", v.Name), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	kubernetesVersion, err := object.NestedField(controlPlane.Object, "spec", "version")
+	if err != nil {
+		return "", nil
+	}
+	s, _ := kubernetesVersion.(string)
+	return s, nil
+}
+
+// checkVersionSkew rejects downgrades and upgrades that skip a minor version
+func checkVersionSkew(current, target string) error {
+	currentVersion, err := utilversion.ParseSemantic(current)
+	if err != nil {
+		return fmt.Errorf("invalid current Kubernetes version %s: %v", current, err)
+	}
+	targetVersion, err := utilversion.ParseSemantic(target)
+	if err != nil {
+		return fmt.Errorf("invalid Kubernetes version %s: %v", target, err)
+	}
+	if targetVersion.LessThan(currentVersion) {
+		return fmt.Errorf("cannot downgrade Kubernetes from %s to %s", current, target)
+	}
+	if targetVersion.Major() != currentVersion.Major() || targetVersion.Minor() > currentVersion.Minor()+1 {
+		return fmt.Errorf("cannot upgrade Kubernetes from %s to %s, upgrade one minor version at a time", current, target)
+	}
+	return nil
+}
+
+// checkImageTags requires the OCNE release and image tags to match the OCNE version mapping
+func checkImageTags(v *variables.Variables, defaults *version.Defaults) error {
+	var mismatches []string
+	check := func(name, actual, expected string) {
+		if actual != expected {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %s, expected %s", name, actual, expected))
+		}
+	}
+	check("OCNE version", v.OCNEVersion, defaults.Release)
+	check("etcd image tag", v.ETCDImageTag, defaults.ContainerImages.ETCD)
+	check("CoreDNS image tag", v.CoreDNSImageTag, defaults.ContainerImages.CoreDNS)
+	check("Tigera operator image tag", v.TigeraTag, defaults.ContainerImages.TigeraOperator)
+	if len(mismatches) > 0 {
+		return fmt.Errorf("cannot upgrade to Kubernetes %s: %s. Use the OCNE version mapping values, or allow custom image tags", v.KubernetesVersion, strings.Join(mismatches, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package capi
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/gvr"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	fake2 "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+const testVersionMapping = `v1.25.7:
+  Release: "1.6"
+  container-images:
+    coredns: v1.9.3
+    etcd: 3.5.6
+    tigera-operator: v1.29.0
+v1.26.6:
+  Release: "1.7"
+  container-images:
+    coredns: v1.9.3
+    etcd: 3.5.6
+    tigera-operator: v1.29.3`
+
+func createTestControlPlane(kubernetesVersion string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(gvr.OCNEControlPlane.GroupVersion().String())
+	u.SetKind("OCNEControlPlane")
+	u.SetName(testName + "-control-plane")
+	u.SetNamespace(testName)
+	_ = unstructured.SetNestedField(u.Object, kubernetesVersion, "spec", "version")
+	return u
+}
+
+func TestCheckUpgrade(t *testing.T) {
+	ki := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ocne-metadata",
+			Namespace: "verrazzano-capi",
+		},
+		Data: map[string]string{
+			"mapping": testVersionMapping,
+		},
+	})
+	notReady := func(objects ...runtime.Object) dynamic.Interface {
+		cluster := createTestCluster(testVariables, false, true, clusterPhaseProvisioned)
+		return fake2.NewSimpleDynamicClient(createTestScheme(), append([]runtime.Object{cluster}, objects...)...)
+	}
+	var tests = []struct {
+		name           string
+		di             dynamic.Interface
+		version        string
+		ocneVersion    string
+		tigeraTag      string
+		allowCustomTag bool
+		err            string
+	}{
+		{
+			"no control plane",
+			createTestDIWithClusterAndMachine(),
+			"v1.26.6",
+			"1.7",
+			"v1.29.3",
+			false,
+			"",
+		},
+		{
+			"same version",
+			notReady(createTestControlPlane("v1.26.6")),
+			"v1.26.6",
+			"1.6",
+			"v1.29.0",
+			false,
+			"",
+		},
+		{
+			"upgrade",
+			createTestDIWithClusterAndMachine(createTestControlPlane("v1.25.7")),
+			"v1.26.6",
+			"1.7",
+			"v1.29.3",
+			false,
+			"",
+		},
+		{
+			"downgrade",
+			createTestDIWithClusterAndMachine(createTestControlPlane("v1.26.6")),
+			"v1.25.7",
+			"1.6",
+			"v1.29.0",
+			false,
+			"cannot downgrade Kubernetes from v1.26.6 to v1.25.7",
+		},
+		{
+			"skip minor version",
+			createTestDIWithClusterAndMachine(createTestControlPlane("v1.24.8")),
+			"v1.26.6",
+			"1.7",
+			"v1.29.3",
+			false,
+			"cannot upgrade Kubernetes from v1.24.8 to v1.26.6, upgrade one minor version at a time",
+		},
+		{
+			"version not in mapping",
+			createTestDIWithClusterAndMachine(createTestControlPlane("v1.25.7")),
+			"v1.26.1",
+			"1.7",
+			"v1.29.3",
+			false,
+			"cannot upgrade to Kubernetes v1.26.1, the version is not in the OCNE version mapping",
+		},
+		{
+			"tags do not match mapping",
+			createTestDIWithClusterAndMachine(createTestControlPlane("v1.25.7")),
+			"v1.26.6",
+			"1.6",
+			"v1.29.0",
+			false,
+			"cannot upgrade to Kubernetes v1.26.6: OCNE version is 1.6, expected 1.7; Tigera operator image tag is v1.29.0, expected v1.29.3. Use the OCNE version mapping values, or allow custom image tags",
+		},
+		{
+			"custom tags allowed",
+			createTestDIWithClusterAndMachine(createTestControlPlane("v1.25.7")),
+			"v1.26.6",
+			"1.6",
+			"v1.29.0",
+			true,
+			"",
+		},
+		{
+			"cluster not ready",
+			notReady(createTestControlPlane("v1.25.7")),
+			"v1.26.6",
+			"1.7",
+			"v1.29.3",
+			false,
+			"cannot upgrade to Kubernetes v1.26.6, the cluster is not ready: Updating, waiting for control plane (0/0 replicas ready), nodes (0/0 machines running)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := *testVariables
+			v.KubernetesVersion = tt.version
+			v.OCNEVersion = tt.ocneVersion
+			v.ETCDImageTag = "3.5.6"
+			v.CoreDNSImageTag = "v1.9.3"
+			v.TigeraTag = tt.tigeraTag
+			v.AllowCustomImageTags = tt.allowCustomTag
+			err := checkUpgrade(context.TODO(), ki, tt.di, &v)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
@@ -5,7 +5,6 @@ package capi
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/capi/object"
 	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/gvr"
@@ -28,10 +27,15 @@ const (
 	verrazzanoModuleOperator   = "verrazzano-module-operator"
 )
 
-func (c *CAPIClient) InstallModules(ctx context.Context, ki kubernetes.Interface, di dynamic.Interface, v *variables.Variables) error {
+func (c *CAPIClient) InstallModules(ctx context.Context, adminKi, ki kubernetes.Interface, di dynamic.Interface, v *variables.Variables) error {
 	if err := c.waitForModuleOperatorReady(ctx, ki); err != nil {
 		return err
 	}
+	if v.InstallClusterAutoscaler {
+		if err := createOrUpdateAutoscalerKubeconfig(ctx, adminKi, ki, v); err != nil {
+			return fmt.Errorf("failed to create cluster autoscaler kubeconfig: %v", err)
+		}
+	}
 	_, err := createOrUpdateObjects(ctx, di, object.Modules(v), v)
 	return err
 }
@@ -110,8 +114,10 @@ func (c *CAPIClient) deleteVZ(ctx context.Context, managedDi dynamic.Interface,
 		return fmt.Errorf("failed to delete Verrazzano resource: %v", err)
 	}
 
-	//
-	return errors.New("uninstalling Verrazzano")
+	return &ProgressingError{
+		Phase:   PhaseDeleting,
+		Message: "uninstalling Verrazzano",
+	}
 }
 
 func createOrUpdateVerrazzano(ctx context.Context, di dynamic.Interface, v *variables.Variables) error {
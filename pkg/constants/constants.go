@@ -19,11 +19,27 @@ const (
 	UsePVNodeEncryption = "use-node-pv-encryption"
 	PodCIDR             = "pod-cidr"
 	ClusterCIDR         = "cluster-cidr"
+	VcnCIDR             = "vcn-cidr"
+	PrivateCluster      = "private-cluster"
+	AllowedCIDRs        = "allowed-cidrs"
+	APIServerCIDRs      = "api-server-allowed-cidrs"
+	SSHCIDRs            = "ssh-allowed-cidrs"
 	ImageDisplayName    = "image-display-name"
 	ImageId             = "image-id"
 
-	RawNodePools = "node-pools"
-	ApplyYAMLs   = "apply-yamls"
+	ControlPlaneSubnetPrefixLength         = "control-plane-subnet-prefix-length"
+	ControlPlaneEndpointSubnetPrefixLength = "control-plane-endpoint-subnet-prefix-length"
+	LoadBalancerSubnetPrefixLength         = "load-balancer-subnet-prefix-length"
+	WorkerSubnetPrefixLength               = "worker-subnet-prefix-length"
+
+	ControlPlaneEndpointSubnet = "control-plane-endpoint-subnet"
+	ControlPlaneNSG            = "control-plane-nsg"
+	ControlPlaneEndpointNSG    = "control-plane-endpoint-nsg"
+	WorkerNodeNSG              = "worker-node-nsg"
+
+	RawNodePools          = "node-pools"
+	NodePoolScalingPolicy = "node-pool-scaling-policy"
+	ApplyYAMLs            = "apply-yamls"
 
 	ControlPlaneOCPUs     = "control-plane-ocpus"
 	NumControlPlaneNodes  = "num-control-plane-nodes"
@@ -31,6 +47,19 @@ const (
 	ControlPlaneShape     = "control-plane-shape"
 	ControlPlaneVolumeGbs = "control-plane-volume-gbs"
 
+	ControlPlaneMachineHealthCheck       = "control-plane-machine-health-check"
+	MachineHealthCheckMaxUnhealthy       = "machine-health-check-max-unhealthy"
+	MachineHealthCheckNodeStartupTimeout = "machine-health-check-node-startup-timeout"
+	MachineHealthCheckUnhealthyTimeout   = "machine-health-check-unhealthy-timeout"
+
+	ControlPlaneMaxSurge                            = "control-plane-max-surge"
+	ControlPlaneRolloutAfter                        = "control-plane-rollout-after"
+	ControlPlaneRolloutBeforeCertificatesExpiryDays = "control-plane-rollout-before-certificates-expiry-days"
+	NodePoolMaxSurge                                = "node-pool-max-surge"
+	NodePoolMaxUnavailable                          = "node-pool-max-unavailable"
+	MinReadySeconds                                 = "min-ready-seconds"
+	NodeDrainTimeout                                = "node-drain-timeout"
+
 	PrivateRegistry = "private-registry"
 	CNEPath         = "cne-path"
 	// TigeraTag used to determine version of tigera operator
@@ -39,6 +68,10 @@ const (
 	CoreDNSTag    = "coredns-image-tag"
 	InstallCalico = "install-calico"
 	InstallCCM    = "install-ccm"
+	// AllowCustomImageTags allows image tags that differ from the OCNE version mapping
+	AllowCustomImageTags = "allow-custom-image-tags"
+
+	InstallClusterAutoscaler = "install-cluster-autoscaler"
 
 	InstallVerrazzano  = "install-verrazzano"
 	VerrazzanoResource = "verrazzano-resource"
@@ -53,4 +86,17 @@ const (
 
 	CloudCredentialId = "cloud-credential-id"
 	Region            = "region"
+	AuthMode          = "auth-mode"
+
+	ServiceAccountTokenExpirationHours = "service-account-token-expiration-hours"
+	ServiceAccountTokenRotationHours   = "service-account-token-rotation-hours"
+	ServiceAccountNamespace            = "service-account-namespace"
+	ServiceAccountClusterRole          = "service-account-cluster-role"
+
+	ETCDBackupS3Endpoint   = "etcd-backup-s3-endpoint"
+	ETCDBackupS3Region     = "etcd-backup-s3-region"
+	ETCDBackupS3Bucket     = "etcd-backup-s3-bucket"
+	ETCDBackupS3Folder     = "etcd-backup-s3-folder"
+	ETCDBackupCredentialId = "etcd-backup-credential-id"
+	ETCDBackupHelperImage  = "etcd-backup-helper-image"
 )
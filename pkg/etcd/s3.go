@@ -0,0 +1,169 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package etcd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+	amzScopeFormat   = "20060102"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	s3Service        = "s3"
+)
+
+// ObjectStore is an S3-compatible bucket, addressed using path-style URLs.
+// Requests are signed with AWS Signature Version 4 query parameters, so snapshot Jobs on the managed cluster
+// can upload and download objects without having the bucket credentials.
+type ObjectStore struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewObjectStore creates a new ObjectStore
+func NewObjectStore(endpoint, region, bucket, accessKey, secretKey string) (*ObjectStore, error) {
+	if endpoint == "" || bucket == "" {
+		return nil, errors.New("etcd backup S3 endpoint and bucket are required")
+	}
+	if accessKey == "" || secretKey == "" {
+		return nil, errors.New("etcd backup S3 credentials are required")
+	}
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = "https://" + endpoint
+	}
+	return &ObjectStore{
+		Endpoint:  strings.TrimSuffix(endpoint, "/"),
+		Region:    region,
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		client:    http.DefaultClient,
+		now:       time.Now,
+	}, nil
+}
+
+// PresignURL creates a URL for the given method and object key that is valid until it expires
+func (o *ObjectStore) PresignURL(method, key string, expires time.Duration) (string, error) {
+	u, err := url.Parse(fmt.Sprintf("%s/%s/%s", o.Endpoint, o.Bucket, strings.TrimPrefix(key, "/")))
+	if err != nil {
+		return "", err
+	}
+	return presign(method, u, o.Region, o.AccessKey, o.SecretKey, o.now().UTC(), expires), nil
+}
+
+// Delete removes an object from the bucket. Deleting an object that does not exist is not an error.
+func (o *ObjectStore) Delete(ctx context.Context, key string) error {
+	deleteURL, err := o.PresignURL(http.MethodDelete, key, 5*time.Minute)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, deleteURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || (resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		return nil
+	}
+	return fmt.Errorf("failed to delete object %s/%s: %s", o.Bucket, key, resp.Status)
+}
+
+// presign computes a SigV4 presigned URL for u
+func presign(method string, u *url.URL, region, accessKey, secretKey string, now time.Time, expires time.Duration) string {
+	amzDate := now.Format(amzDateFormat)
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", now.Format(amzScopeFormat), region, s3Service)
+
+	query := map[string]string{
+		"X-Amz-Algorithm":     signingAlgorithm,
+		"X-Amz-Credential":    accessKey + "/" + scope,
+		"X-Amz-Date":          amzDate,
+		"X-Amz-Expires":       fmt.Sprintf("%d", int64(expires.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+	canonicalQuery := canonicalQueryString(query)
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalPath(u.Path),
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	stringToSign := strings.Join([]string{
+		signingAlgorithm,
+		amzDate,
+		scope,
+		sha256Hex(canonicalRequest),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), now.Format(amzScopeFormat))
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, s3Service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	return fmt.Sprintf("%s://%s%s?%s&X-Amz-Signature=%s", u.Scheme, u.Host, canonicalPath(u.Path), canonicalQuery, signature)
+}
+
+func canonicalQueryString(query map[string]string) string {
+	var keys []string
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		params = append(params, uriEncode(k)+"="+uriEncode(query[k]))
+	}
+	return strings.Join(params, "&")
+}
+
+func canonicalPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// uriEncode encodes a string per RFC 3986, as required by SigV4
+func uriEncode(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,588 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package etcd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/variables"
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotConfigMapName = "%s-etcd-snapshots"
+	snapshotNamespace     = "kube-system"
+	snapshotFile          = "/snapshot/snapshot.db"
+
+	accessKeyField = "accessKey"
+	secretKeyField = "secretKey"
+
+	controlPlaneLabel = "node-role.kubernetes.io/control-plane"
+	snapshotJobLabel  = "verrazzano.io/etcd-snapshot"
+)
+
+// staticPodListeners matches sockets listening on the etcd client and peer ports, or the API server port, in /proc/net/tcp.
+// The restore Jobs use the host network, so these are the sockets of the etcd and kube-apiserver static pods.
+const staticPodListeners = `:(094B|094C|192B) [0-9A-F]+:0000 0A`
+
+// Snapshot is the metadata recorded for each etcd snapshot
+type Snapshot struct {
+	Name              string    `json:"name"`
+	Key               string    `json:"key"`
+	Bucket            string    `json:"bucket"`
+	KubernetesVersion string    `json:"kubernetesVersion"`
+	ETCDImageTag      string    `json:"etcdImageTag"`
+	CreatedAt         time.Time `json:"createdAt"`
+}
+
+// SnapshotClient takes, restores and removes etcd snapshots of a managed cluster.
+// Snapshots are taken by Jobs on the managed cluster control plane nodes, and stored in an S3-compatible bucket.
+// Snapshot metadata is recorded in a ConfigMap in the cluster namespace of the admin cluster.
+type SnapshotClient struct {
+	jobTimeout         time.Duration
+	jobPollingInterval time.Duration
+
+	adminKi   kubernetes.Interface
+	managedKi kubernetes.Interface
+	store     *ObjectStore
+	v         *variables.Variables
+	logger    *zap.SugaredLogger
+}
+
+// NewSnapshotClient creates a SnapshotClient, loading the bucket credentials from the admin cluster
+func NewSnapshotClient(ctx context.Context, logger *zap.SugaredLogger, adminKi, managedKi kubernetes.Interface, v *variables.Variables) (*SnapshotClient, error) {
+	if v.ETCDBackupS3Bucket == "" || v.ETCDBackupS3Endpoint == "" {
+		return nil, errors.New("etcd backups are not configured for this cluster")
+	}
+	name, namespace := v.ETCDBackupCredentialNameAndNamespace()
+	credentials, err := adminKi.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get etcd backup credentials %s/%s: %v", namespace, name, err)
+	}
+	store, err := NewObjectStore(v.ETCDBackupS3Endpoint, v.ETCDBackupS3Region, v.ETCDBackupS3Bucket, string(credentials.Data[accessKeyField]), string(credentials.Data[secretKeyField]))
+	if err != nil {
+		return nil, err
+	}
+	return &SnapshotClient{
+		jobTimeout:         10 * time.Minute,
+		jobPollingInterval: 5 * time.Second,
+		adminKi:            adminKi,
+		managedKi:          managedKi,
+		store:              store,
+		v:                  v,
+		logger:             logger,
+	}, nil
+}
+
+// Save takes an etcd snapshot from a control plane node and uploads it to the bucket
+func (s *SnapshotClient) Save(ctx context.Context, snapshotName string) error {
+	key := s.snapshotKey(snapshotName)
+	uploadURL, err := s.store.PresignURL(http.MethodPut, key, s.jobTimeout+5*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	job := s.saveJob(snapshotName, uploadURL)
+	s.logger.Infof("Saving etcd snapshot %s for cluster %s", snapshotName, s.v.Name)
+	if err := s.runJobs(ctx, job); err != nil {
+		return fmt.Errorf("failed to save etcd snapshot %s: %v", snapshotName, err)
+	}
+
+	return s.putSnapshot(ctx, &Snapshot{
+		Name:              snapshotName,
+		Key:               key,
+		Bucket:            s.store.Bucket,
+		KubernetesVersion: s.v.KubernetesVersion,
+		ETCDImageTag:      s.v.ETCDImageTag,
+		CreatedAt:         time.Now().UTC(),
+	})
+}
+
+// Restore restores a named etcd snapshot onto every control plane node
+func (s *SnapshotClient) Restore(ctx context.Context, snapshotName string) error {
+	snapshot, err := s.GetSnapshot(ctx, snapshotName)
+	if err != nil {
+		return err
+	}
+	if snapshot == nil {
+		return fmt.Errorf("etcd snapshot %s not found for cluster %s", snapshotName, s.v.Name)
+	}
+	downloadURL, err := s.store.PresignURL(http.MethodGet, snapshot.Key, s.jobTimeout+5*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := s.managedKi.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+		LabelSelector: controlPlaneLabel,
+	})
+	if err != nil {
+		return err
+	}
+	if len(nodes.Items) < 1 {
+		return errors.New("no control plane nodes found to restore etcd snapshot")
+	}
+
+	var initialCluster []string
+	for _, node := range nodes.Items {
+		initialCluster = append(initialCluster, fmt.Sprintf("%s=https://%s:2380", node.Name, nodeAddress(node)))
+	}
+	var jobs []*batchv1.Job
+	for _, node := range nodes.Items {
+		jobs = append(jobs, s.restoreJob(snapshotName, downloadURL, node, strings.Join(initialCluster, ",")))
+	}
+	s.logger.Infof("Restoring etcd snapshot %s on cluster %s", snapshotName, s.v.Name)
+	if err := s.runRestoreJobs(ctx, jobs, nodes.Items); err != nil {
+		return fmt.Errorf("failed to restore etcd snapshot %s: %v", snapshotName, err)
+	}
+	return nil
+}
+
+// Remove deletes a named etcd snapshot from the bucket, and removes its metadata
+func (s *SnapshotClient) Remove(ctx context.Context, snapshotName string) error {
+	snapshot, err := s.GetSnapshot(ctx, snapshotName)
+	if err != nil {
+		return err
+	}
+	key := s.snapshotKey(snapshotName)
+	if snapshot != nil {
+		key = snapshot.Key
+	}
+	if err := s.store.Delete(ctx, key); err != nil {
+		return err
+	}
+	return s.deleteSnapshot(ctx, snapshotName)
+}
+
+// GetSnapshot returns the metadata of a named snapshot, or nil if the snapshot is not known
+func (s *SnapshotClient) GetSnapshot(ctx context.Context, snapshotName string) (*Snapshot, error) {
+	cm, err := s.getConfigMap(ctx)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	data, ok := cm.Data[snapshotName]
+	if !ok {
+		return nil, nil
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal([]byte(data), snapshot); err != nil {
+		return nil, fmt.Errorf("invalid metadata for etcd snapshot %s: %v", snapshotName, err)
+	}
+	return snapshot, nil
+}
+
+func (s *SnapshotClient) putSnapshot(ctx context.Context, snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	cm, err := s.getConfigMap(ctx)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		_, err = s.adminKi.CoreV1().ConfigMaps(s.v.Namespace).Create(ctx, &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf(snapshotConfigMapName, s.v.Name),
+				Namespace: s.v.Namespace,
+			},
+			Data: map[string]string{
+				snapshot.Name: string(data),
+			},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[snapshot.Name] = string(data)
+	_, err = s.adminKi.CoreV1().ConfigMaps(s.v.Namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	return err
+}
+
+func (s *SnapshotClient) deleteSnapshot(ctx context.Context, snapshotName string) error {
+	cm, err := s.getConfigMap(ctx)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if _, ok := cm.Data[snapshotName]; !ok {
+		return nil
+	}
+	delete(cm.Data, snapshotName)
+	_, err = s.adminKi.CoreV1().ConfigMaps(s.v.Namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	return err
+}
+
+func (s *SnapshotClient) getConfigMap(ctx context.Context) (*v1.ConfigMap, error) {
+	return s.adminKi.CoreV1().ConfigMaps(s.v.Namespace).Get(ctx, fmt.Sprintf(snapshotConfigMapName, s.v.Name), metav1.GetOptions{})
+}
+
+func (s *SnapshotClient) snapshotKey(snapshotName string) string {
+	return path.Join(s.v.ETCDBackupS3Folder, s.v.Name, snapshotName+".db")
+}
+
+// runJobs creates the Jobs on the managed cluster, waits for them to complete, and then cleans them up
+func (s *SnapshotClient) runJobs(ctx context.Context, jobs ...*batchv1.Job) error {
+	if _, err := s.createJobs(ctx, jobs...); err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if err := s.waitForJob(ctx, job.Name); err != nil {
+			return err
+		}
+	}
+	return s.deleteJobs(ctx, jobs...)
+}
+
+// runRestoreJobs creates the restore Jobs on the managed cluster, waits for etcd to be restored on every control plane node,
+// and then cleans up any Jobs that are left.
+func (s *SnapshotClient) runRestoreJobs(ctx context.Context, jobs []*batchv1.Job, nodes []v1.Node) error {
+	since, err := s.createJobs(ctx, jobs...)
+	if err != nil {
+		return err
+	}
+	if err := s.waitForRestore(ctx, jobs, nodes, since); err != nil {
+		return err
+	}
+	return s.deleteJobs(ctx, jobs...)
+}
+
+// createJobs creates the Jobs on the managed cluster, returning the earliest creation time recorded by the API server
+func (s *SnapshotClient) createJobs(ctx context.Context, jobs ...*batchv1.Job) (time.Time, error) {
+	var since time.Time
+	for _, job := range jobs {
+		if err := s.deleteJob(ctx, job.Name); err != nil {
+			return since, err
+		}
+		created, err := s.managedKi.BatchV1().Jobs(snapshotNamespace).Create(ctx, job, metav1.CreateOptions{})
+		if err != nil {
+			return since, err
+		}
+		if since.IsZero() || created.CreationTimestamp.Time.Before(since) {
+			since = created.CreationTimestamp.Time
+		}
+	}
+	return since, nil
+}
+
+func (s *SnapshotClient) deleteJobs(ctx context.Context, jobs ...*batchv1.Job) error {
+	for _, job := range jobs {
+		if err := s.deleteJob(ctx, job.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SnapshotClient) waitForJob(ctx context.Context, name string) error {
+	endTime := time.Now().Add(s.jobTimeout)
+	for {
+		job, err := s.managedKi.BatchV1().Jobs(snapshotNamespace).Get(ctx, name, metav1.GetOptions{})
+		// The API server may be briefly unavailable, so errors are retried until timeout
+		if err == nil {
+			if job.Status.Succeeded > 0 {
+				return nil
+			}
+			if job.Status.Failed > 0 {
+				return fmt.Errorf("job %s/%s failed", snapshotNamespace, name)
+			}
+		}
+		if time.Now().After(endTime) {
+			return fmt.Errorf("timed out waiting for job %s/%s to complete", snapshotNamespace, name)
+		}
+		time.Sleep(s.jobPollingInterval)
+	}
+}
+
+// waitForRestore waits until every restore Job has swapped in the snapshot, and etcd and the API server are healthy again on every control plane node.
+// The restore Jobs are created after the snapshot was taken, so they no longer exist once etcd is rolled back to the snapshot.
+func (s *SnapshotClient) waitForRestore(ctx context.Context, jobs []*batchv1.Job, nodes []v1.Node, since time.Time) error {
+	endTime := time.Now().Add(s.jobTimeout)
+	for {
+		restored, err := s.isRestored(ctx, jobs, nodes, since)
+		if err != nil {
+			return err
+		}
+		if restored {
+			return nil
+		}
+		if time.Now().After(endTime) {
+			return fmt.Errorf("timed out waiting for etcd to be restored on cluster %s", s.v.Name)
+		}
+		time.Sleep(s.jobPollingInterval)
+	}
+}
+
+func (s *SnapshotClient) isRestored(ctx context.Context, jobs []*batchv1.Job, nodes []v1.Node, since time.Time) (bool, error) {
+	for _, job := range jobs {
+		current, err := s.managedKi.BatchV1().Jobs(snapshotNamespace).Get(ctx, job.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			// etcd was rolled back to before the Job was created
+		case err != nil:
+			// The API server is unavailable while etcd is restored
+			return false, nil
+		case current.Status.Failed > 0:
+			return false, fmt.Errorf("job %s/%s failed", snapshotNamespace, job.Name)
+		case current.Status.Succeeded < 1:
+			return false, nil
+		}
+	}
+	for _, node := range nodes {
+		current, err := s.managedKi.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+		if err != nil || !isNodeReady(current) {
+			return false, nil
+		}
+		for _, component := range []string{"etcd", "kube-apiserver"} {
+			pod, err := s.managedKi.CoreV1().Pods(snapshotNamespace).Get(ctx, fmt.Sprintf("%s-%s", component, node.Name), metav1.GetOptions{})
+			if err != nil || !isRestartedSince(pod, since) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func isNodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// isRestartedSince is true if every container of a static pod is ready, and was started after the given time.
+// Static pod status restored from the snapshot predates the restore, so it is not mistaken for a healthy restart.
+func isRestartedSince(pod *v1.Pod, since time.Time) bool {
+	if len(pod.Status.ContainerStatuses) < 1 {
+		return false
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if !status.Ready || status.State.Running == nil || status.State.Running.StartedAt.Time.Before(since) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *SnapshotClient) deleteJob(ctx context.Context, name string) error {
+	propagation := metav1.DeletePropagationBackground
+	err := s.managedKi.BatchV1().Jobs(snapshotNamespace).Delete(ctx, name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *SnapshotClient) saveJob(snapshotName, uploadURL string) *batchv1.Job {
+	job := s.newJob(jobName("etcd-save", snapshotName), snapshotName)
+	spec := &job.Spec.Template.Spec
+	spec.NodeSelector = map[string]string{
+		controlPlaneLabel: "",
+	}
+	spec.Volumes = []v1.Volume{
+		hostPathVolume("etcd-certs", "/etc/kubernetes/pki/etcd"),
+		{Name: "snapshot", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+	}
+	spec.InitContainers = []v1.Container{
+		{
+			Name:    "snapshot",
+			Image:   s.etcdImage(),
+			Command: append(etcdctlCommand(), "snapshot", "save", snapshotFile),
+			Env: []v1.EnvVar{
+				{Name: "ETCDCTL_API", Value: "3"},
+			},
+			VolumeMounts: []v1.VolumeMount{
+				{Name: "etcd-certs", MountPath: "/etc/kubernetes/pki/etcd", ReadOnly: true},
+				{Name: "snapshot", MountPath: path.Dir(snapshotFile)},
+			},
+		},
+	}
+	spec.Containers = []v1.Container{
+		{
+			Name:    "upload",
+			Image:   s.v.ETCDBackupHelperImage,
+			Command: []string{"/bin/sh", "-c", fmt.Sprintf(`curl -sSf -X PUT -T %s "$SNAPSHOT_URL"`, snapshotFile)},
+			Env: []v1.EnvVar{
+				{Name: "SNAPSHOT_URL", Value: uploadURL},
+			},
+			VolumeMounts: []v1.VolumeMount{
+				{Name: "snapshot", MountPath: path.Dir(snapshotFile)},
+			},
+		},
+	}
+	return job
+}
+
+// restoreJob restores the snapshot into a new etcd data directory on a control plane node,
+// and then swaps it in while the etcd and kube-apiserver static pods are stopped.
+func (s *SnapshotClient) restoreJob(snapshotName, downloadURL string, node v1.Node, initialCluster string) *batchv1.Job {
+	job := s.newJob(jobName("etcd-restore", snapshotName, node.Name), snapshotName)
+	privileged := true
+	spec := &job.Spec.Template.Spec
+	spec.NodeName = node.Name
+	spec.Volumes = []v1.Volume{
+		hostPathVolume("manifests", "/etc/kubernetes/manifests"),
+		hostPathVolume("etcd-data", "/var/lib/etcd-restore"),
+		hostPathVolume("var-lib", "/var/lib"),
+		{Name: "snapshot", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+	}
+	spec.InitContainers = []v1.Container{
+		{
+			Name:    "download",
+			Image:   s.v.ETCDBackupHelperImage,
+			Command: []string{"/bin/sh", "-c", fmt.Sprintf(`rm -rf /var/lib/etcd-restore/etcd && curl -sSf -o %s "$SNAPSHOT_URL"`, snapshotFile)},
+			Env: []v1.EnvVar{
+				{Name: "SNAPSHOT_URL", Value: downloadURL},
+			},
+			VolumeMounts: []v1.VolumeMount{
+				{Name: "etcd-data", MountPath: "/var/lib/etcd-restore"},
+				{Name: "snapshot", MountPath: path.Dir(snapshotFile)},
+			},
+		},
+		{
+			Name:  "restore",
+			Image: s.etcdImage(),
+			Command: []string{
+				"etcdctl", "snapshot", "restore", snapshotFile,
+				"--name", node.Name,
+				"--initial-cluster", initialCluster,
+				"--initial-advertise-peer-urls", fmt.Sprintf("https://%s:2380", nodeAddress(node)),
+				"--data-dir", "/var/lib/etcd-restore/etcd",
+			},
+			Env: []v1.EnvVar{
+				{Name: "ETCDCTL_API", Value: "3"},
+			},
+			VolumeMounts: []v1.VolumeMount{
+				{Name: "etcd-data", MountPath: "/var/lib/etcd-restore"},
+				{Name: "snapshot", MountPath: path.Dir(snapshotFile)},
+			},
+		},
+	}
+	spec.Containers = []v1.Container{
+		{
+			Name:  "swap",
+			Image: s.v.ETCDBackupHelperImage,
+			Command: []string{"/bin/sh", "-c", strings.Join([]string{
+				"set -e",
+				"mkdir -p /host/manifests-stopped",
+				"mv /host/manifests/etcd.yaml /host/manifests/kube-apiserver.yaml /host/manifests-stopped/",
+				fmt.Sprintf("for i in $(seq 60); do grep -qsE '%s' /proc/net/tcp /proc/net/tcp6 || break; sleep 2; done", staticPodListeners),
+				fmt.Sprintf("! grep -qsE '%s' /proc/net/tcp /proc/net/tcp6", staticPodListeners),
+				"rm -rf /host/var/lib/etcd.bak",
+				"mv /host/var/lib/etcd /host/var/lib/etcd.bak",
+				"mv /host/var/lib/etcd-restore/etcd /host/var/lib/etcd",
+				"mv /host/manifests-stopped/etcd.yaml /host/manifests-stopped/kube-apiserver.yaml /host/manifests/",
+			}, " && ")},
+			SecurityContext: &v1.SecurityContext{
+				Privileged: &privileged,
+			},
+			VolumeMounts: []v1.VolumeMount{
+				{Name: "manifests", MountPath: "/host/manifests"},
+				{Name: "var-lib", MountPath: "/host/var/lib"},
+			},
+		},
+	}
+	return job
+}
+
+func (s *SnapshotClient) newJob(name, snapshotName string) *batchv1.Job {
+	var backoffLimit int32
+	ttl := int32(s.jobTimeout.Seconds())
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: snapshotNamespace,
+			Labels: map[string]string{
+				snapshotJobLabel: jobName("", snapshotName),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttl,
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					HostNetwork:   true,
+					RestartPolicy: v1.RestartPolicyNever,
+					Tolerations: []v1.Toleration{
+						{Key: controlPlaneLabel, Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule},
+						{Key: "node-role.kubernetes.io/master", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (s *SnapshotClient) etcdImage() string {
+	repository := "container-registry.oracle.com/olcne"
+	if s.v.PrivateRegistry != "" {
+		repository = fmt.Sprintf("%s/%s", s.v.PrivateRegistry, s.v.CNEPath)
+	}
+	return fmt.Sprintf("%s/etcd:%s", repository, s.v.ETCDImageTag)
+}
+
+func etcdctlCommand() []string {
+	return []string{
+		"etcdctl",
+		"--endpoints=https://127.0.0.1:2379",
+		"--cacert=/etc/kubernetes/pki/etcd/ca.crt",
+		"--cert=/etc/kubernetes/pki/etcd/server.crt",
+		"--key=/etc/kubernetes/pki/etcd/server.key",
+	}
+}
+
+func hostPathVolume(name, hostPath string) v1.Volume {
+	hostPathType := v1.HostPathDirectoryOrCreate
+	return v1.Volume{
+		Name: name,
+		VolumeSource: v1.VolumeSource{
+			HostPath: &v1.HostPathVolumeSource{
+				Path: hostPath,
+				Type: &hostPathType,
+			},
+		},
+	}
+}
+
+func nodeAddress(node v1.Node) string {
+	for _, address := range node.Status.Addresses {
+		if address.Type == v1.NodeInternalIP {
+			return address.Address
+		}
+	}
+	return node.Name
+}
+
+// jobName creates a DNS-1123 compliant name from a prefix and a short hash of the parts
+func jobName(prefix string, parts ...string) string {
+	sha := sha256.New()
+	sha.Write([]byte(strings.Join(parts, "/")))
+	encoded := strings.ToLower(base32.StdEncoding.EncodeToString(sha.Sum(nil))[0:8])
+	if prefix == "" {
+		return encoded
+	}
+	return prefix + "-" + encoded
+}
@@ -0,0 +1,362 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package etcd
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/variables"
+	"go.uber.org/zap"
+	"io"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testName = "test"
+)
+
+// testS3 is a minimal in-memory stand-in for an S3-compatible bucket
+type testS3 struct {
+	*httptest.Server
+	objects map[string][]byte
+}
+
+func newTestS3() *testS3 {
+	s := &testS3{
+		objects: map[string][]byte{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("X-Amz-Signature") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			s.objects[r.URL.Path] = data
+		case http.MethodGet:
+			data, ok := s.objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(data)
+		case http.MethodDelete:
+			if _, ok := s.objects[r.URL.Path]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(s.objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	return s
+}
+
+// uploadFromJob simulates the snapshot job uploading a snapshot to the presigned URL
+func (s *testS3) uploadFromJob(job *batchv1.Job) error {
+	for _, env := range job.Spec.Template.Spec.Containers[0].Env {
+		if env.Name == "SNAPSHOT_URL" {
+			req, err := http.NewRequest(http.MethodPut, env.Value, strings.NewReader("snapshot"))
+			if err != nil {
+				return err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			return resp.Body.Close()
+		}
+	}
+	return nil
+}
+
+func testVariables(endpoint string) *variables.Variables {
+	return &variables.Variables{
+		Name:                   testName,
+		Namespace:              testName,
+		KubernetesVersion:      "v1.25.7",
+		ETCDImageTag:           "3.5.6",
+		ETCDBackupS3Endpoint:   endpoint,
+		ETCDBackupS3Bucket:     "bucket",
+		ETCDBackupS3Region:     "r",
+		ETCDBackupS3Folder:     "snapshots",
+		ETCDBackupCredentialId: "cattle-global-data:s3-creds",
+		ETCDBackupHelperImage:  variables.DefaultETCDBackupHelperImage,
+	}
+}
+
+func testCredentials() *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "s3-creds",
+			Namespace: "cattle-global-data",
+		},
+		Data: map[string][]byte{
+			accessKeyField: []byte("a"),
+			secretKeyField: []byte("s"),
+		},
+	}
+}
+
+func testControlPlaneNode(name, ip string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				controlPlaneLabel: "",
+			},
+		},
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: ip},
+			},
+			Conditions: []v1.NodeCondition{
+				{Type: v1.NodeReady, Status: v1.ConditionTrue},
+			},
+		},
+	}
+}
+
+// testStaticPod is a control plane static pod, with a container started now
+func testStaticPod(component, nodeName string, ready bool) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      component + "-" + nodeName,
+			Namespace: snapshotNamespace,
+		},
+		Status: v1.PodStatus{
+			ContainerStatuses: []v1.ContainerStatus{
+				{
+					Name:  component,
+					Ready: ready,
+					State: v1.ContainerState{
+						Running: &v1.ContainerStateRunning{StartedAt: metav1.Now()},
+					},
+				},
+			},
+		},
+	}
+}
+
+// testControlPlane is a healthy control plane of two nodes
+func testControlPlane() []runtime.Object {
+	return []runtime.Object{
+		testControlPlaneNode("cp-1", "10.0.0.2"),
+		testControlPlaneNode("cp-2", "10.0.0.3"),
+		testStaticPod("etcd", "cp-1", true),
+		testStaticPod("kube-apiserver", "cp-1", true),
+		testStaticPod("etcd", "cp-2", true),
+		testStaticPod("kube-apiserver", "cp-2", true),
+	}
+}
+
+// completeJobs marks every created Job as succeeded, optionally running a hook for the created job
+func completeJobs(ki *fake.Clientset, hook func(job *batchv1.Job) error) {
+	ki.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+		if hook != nil {
+			if err := hook(job); err != nil {
+				job.Status.Failed = 1
+				return false, nil, nil
+			}
+		}
+		job.Status.Succeeded = 1
+		return false, nil, nil
+	})
+}
+
+func newTestSnapshotClient(t *testing.T, s3 *testS3, managedKi *fake.Clientset) *SnapshotClient {
+	s, err := NewSnapshotClient(context.TODO(), zap.S(), fake.NewSimpleClientset(testCredentials()), managedKi, testVariables(s3.URL))
+	assert.NoError(t, err)
+	s.jobPollingInterval = time.Millisecond
+	s.jobTimeout = time.Second
+	return s
+}
+
+func TestNewSnapshotClient(t *testing.T) {
+	v := testVariables("http://localhost")
+	v.ETCDBackupS3Bucket = ""
+	_, err := NewSnapshotClient(context.TODO(), zap.S(), fake.NewSimpleClientset(testCredentials()), fake.NewSimpleClientset(), v)
+	assert.Error(t, err)
+
+	v = testVariables("http://localhost")
+	_, err = NewSnapshotClient(context.TODO(), zap.S(), fake.NewSimpleClientset(), fake.NewSimpleClientset(), v)
+	assert.Error(t, err)
+}
+
+func TestSaveAndRemove(t *testing.T) {
+	ctx := context.TODO()
+	s3 := newTestS3()
+	defer s3.Close()
+	managedKi := fake.NewSimpleClientset()
+	completeJobs(managedKi, s3.uploadFromJob)
+	s := newTestSnapshotClient(t, s3, managedKi)
+
+	assert.NoError(t, s.Save(ctx, "snap-1"))
+	assert.Equal(t, []byte("snapshot"), s3.objects["/bucket/snapshots/test/snap-1.db"])
+	snapshot, err := s.GetSnapshot(ctx, "snap-1")
+	assert.NoError(t, err)
+	assert.NotNil(t, snapshot)
+	assert.Equal(t, "snapshots/test/snap-1.db", snapshot.Key)
+	assert.Equal(t, "3.5.6", snapshot.ETCDImageTag)
+
+	// Jobs are cleaned up after completion
+	jobs, err := managedKi.BatchV1().Jobs(snapshotNamespace).List(ctx, metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, jobs.Items, 0)
+
+	assert.NoError(t, s.Remove(ctx, "snap-1"))
+	assert.Len(t, s3.objects, 0)
+	snapshot, err = s.GetSnapshot(ctx, "snap-1")
+	assert.NoError(t, err)
+	assert.Nil(t, snapshot)
+}
+
+func TestSaveJobFailed(t *testing.T) {
+	s3 := newTestS3()
+	defer s3.Close()
+	managedKi := fake.NewSimpleClientset()
+	managedKi.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		action.(k8stesting.CreateAction).GetObject().(*batchv1.Job).Status.Failed = 1
+		return false, nil, nil
+	})
+	s := newTestSnapshotClient(t, s3, managedKi)
+
+	assert.Error(t, s.Save(context.TODO(), "snap-1"))
+	snapshot, err := s.GetSnapshot(context.TODO(), "snap-1")
+	assert.NoError(t, err)
+	assert.Nil(t, snapshot)
+}
+
+func TestRestore(t *testing.T) {
+	ctx := context.TODO()
+	s3 := newTestS3()
+	defer s3.Close()
+	managedKi := fake.NewSimpleClientset(testControlPlane()...)
+	var restoreJobs []*batchv1.Job
+	completeJobs(managedKi, func(job *batchv1.Job) error {
+		if strings.HasPrefix(job.Name, "etcd-restore") {
+			restoreJobs = append(restoreJobs, job.DeepCopy())
+			return nil
+		}
+		return s3.uploadFromJob(job)
+	})
+	s := newTestSnapshotClient(t, s3, managedKi)
+
+	// unknown snapshots cannot be restored
+	assert.Error(t, s.Restore(ctx, "snap-1"))
+
+	assert.NoError(t, s.Save(ctx, "snap-1"))
+	assert.NoError(t, s.Restore(ctx, "snap-1"))
+	assert.Len(t, restoreJobs, 2)
+	for _, job := range restoreJobs {
+		restore := job.Spec.Template.Spec.InitContainers[1]
+		assert.Equal(t, "container-registry.oracle.com/olcne/etcd:3.5.6", restore.Image)
+		assert.Contains(t, restore.Command, "cp-1=https://10.0.0.2:2380,cp-2=https://10.0.0.3:2380")
+	}
+	assert.NotEqual(t, restoreJobs[0].Spec.Template.Spec.NodeName, restoreJobs[1].Spec.Template.Spec.NodeName)
+}
+
+// TestRestoreJobsRolledBack asserts that a restore completes once etcd is rolled back to before the restore Jobs existed
+func TestRestoreJobsRolledBack(t *testing.T) {
+	ctx := context.TODO()
+	s3 := newTestS3()
+	defer s3.Close()
+
+	var tests = []struct {
+		name    string
+		objects []runtime.Object
+		isError bool
+	}{
+		{
+			"healthy control plane",
+			testControlPlane(),
+			false,
+		},
+		{
+			"etcd not ready",
+			[]runtime.Object{
+				testControlPlaneNode("cp-1", "10.0.0.2"),
+				testStaticPod("etcd", "cp-1", false),
+				testStaticPod("kube-apiserver", "cp-1", true),
+			},
+			true,
+		},
+		{
+			"API server not restarted",
+			[]runtime.Object{
+				testControlPlaneNode("cp-1", "10.0.0.2"),
+				testStaticPod("etcd", "cp-1", true),
+			},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			managedKi := fake.NewSimpleClientset(tt.objects...)
+			completeJobs(managedKi, func(job *batchv1.Job) error {
+				if strings.HasPrefix(job.Name, "etcd-restore") {
+					return nil
+				}
+				return s3.uploadFromJob(job)
+			})
+			// the restore Jobs are gone once etcd is rolled back to the snapshot
+			managedKi.PrependReactor("get", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				name := action.(k8stesting.GetAction).GetName()
+				if strings.HasPrefix(name, "etcd-restore") {
+					return true, nil, apierrors.NewNotFound(batchv1.Resource("jobs"), name)
+				}
+				return false, nil, nil
+			})
+			s := newTestSnapshotClient(t, s3, managedKi)
+			s.jobTimeout = 100 * time.Millisecond
+
+			assert.NoError(t, s.Save(ctx, "snap-1"))
+			err := s.Restore(ctx, "snap-1")
+			if tt.isError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRestoreSwapWaitsForStaticPods(t *testing.T) {
+	s3 := newTestS3()
+	defer s3.Close()
+	s := newTestSnapshotClient(t, s3, fake.NewSimpleClientset())
+	job := s.restoreJob("snap-1", s3.URL, *testControlPlaneNode("cp-1", "10.0.0.2"), "cp-1=https://10.0.0.2:2380")
+	steps := strings.Split(job.Spec.Template.Spec.Containers[0].Command[2], " && ")
+	index := func(prefix string) int {
+		for i, step := range steps {
+			if strings.HasPrefix(step, prefix) {
+				return i
+			}
+		}
+		assert.Fail(t, "missing step", prefix)
+		return -1
+	}
+	stopManifests := index("mv /host/manifests/etcd.yaml /host/manifests/kube-apiserver.yaml /host/manifests-stopped/")
+	waitForListeners := index("for i in $(seq 60); do grep -qsE '" + staticPodListeners + "' /proc/net/tcp /proc/net/tcp6 || break; sleep 2; done")
+	checkListeners := index("! grep -qsE '" + staticPodListeners + "' /proc/net/tcp /proc/net/tcp6")
+	swapData := index("mv /host/var/lib/etcd /host/var/lib/etcd.bak")
+	startManifests := index("mv /host/manifests-stopped/etcd.yaml /host/manifests-stopped/kube-apiserver.yaml /host/manifests/")
+
+	// the static pods are stopped, and the data directory is only swapped once they no longer listen
+	assert.IsIncreasing(t, []int{stopManifests, waitForListeners, checkListeners, swapData, startManifests})
+}
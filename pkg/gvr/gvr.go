@@ -39,6 +39,12 @@ var ClusterIdentity = schema.GroupVersionResource{
 	Resource: "ociclusteridentities",
 }
 
+var MachineHealthCheck = schema.GroupVersionResource{
+	Group:    ClusterXK8sIO,
+	Version:  V1Beta1Version,
+	Resource: "machinehealthchecks",
+}
+
 var Machine = schema.GroupVersionResource{
 	Group:    ClusterXK8sIO,
 	Version:  V1Beta1Version,
@@ -86,3 +92,9 @@ var VerrazzanoManagedCluster = schema.GroupVersionResource{
 	Version:  V1Alpha1Version,
 	Resource: "verrazzanomanagedclusters",
 }
+
+var OCIMachine = schema.GroupVersionResource{
+	Group:    InfrastructureXK8sIO,
+	Version:  V1Beta1Version,
+	Resource: "ocimachines",
+}
@@ -6,9 +6,11 @@ package k8s
 import (
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"os"
 )
 
@@ -48,6 +50,38 @@ func NewInterfaceForKubeconfig(kubeconfig []byte) (kubernetes.Interface, error)
 	return kubernetes.NewForConfig(config)
 }
 
+// NewKubeconfigForToken creates a kubeconfig for the current cluster of a kubeconfig, which authenticates with a bearer token instead of the kubeconfig's credentials
+func NewKubeconfigForToken(kubeconfig []byte, user, token string) ([]byte, error) {
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	// inline any certificate authority files, so the kubeconfig can be used elsewhere
+	if err := clientcmdapi.FlattenConfig(config); err != nil {
+		return nil, err
+	}
+	current, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return nil, fmt.Errorf("kubeconfig context %s not found", config.CurrentContext)
+	}
+	cluster, ok := config.Clusters[current.Cluster]
+	if !ok {
+		return nil, fmt.Errorf("kubeconfig cluster %s not found", current.Cluster)
+	}
+
+	tokenConfig := clientcmdapi.NewConfig()
+	tokenConfig.Clusters[current.Cluster] = cluster
+	tokenConfig.AuthInfos[user] = &clientcmdapi.AuthInfo{
+		Token: token,
+	}
+	tokenConfig.Contexts[user] = &clientcmdapi.Context{
+		Cluster:  current.Cluster,
+		AuthInfo: user,
+	}
+	tokenConfig.CurrentContext = user
+	return clientcmd.Write(*tokenConfig)
+}
+
 func NewDynamicForKubeconfig(kubeconfig []byte) (dynamic.Interface, error) {
 	config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
 	if err != nil {
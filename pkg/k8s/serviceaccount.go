@@ -0,0 +1,415 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"reflect"
+	"time"
+)
+
+const (
+	DefaultServiceAccountName      = "kontainer-engine-olcne"
+	DefaultServiceAccountNamespace = "default"
+	DefaultClusterRole             = "cluster-admin"
+	// RestrictedClusterRole is a built-in cluster role, limited to what Rancher needs to bootstrap its agents
+	RestrictedClusterRole = "kontainer-engine-olcne-restricted"
+	// rancherAgentClusterRole and rancherProxyClusterRole are the cluster roles Rancher creates and binds for its cluster agent
+	rancherAgentClusterRole = "cattle-admin"
+	rancherProxyClusterRole = "proxy-clusterrole-kubeapiserver"
+
+	defaultTokenTimeout         = 2 * time.Minute
+	defaultTokenPollingInterval = 2 * time.Second
+)
+
+// restrictedClusterRoleRules lets Rancher deploy its cluster agent into cattle-system.
+// Roles can only be bound or escalated to the Rancher agent roles, so the service account cannot bind itself to cluster-admin.
+// The Rancher agent role is itself a cluster-wide admin role, so the restricted role is still admin-equivalent.
+var restrictedClusterRoleRules = []rbacv1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"namespaces"},
+		Verbs:     []string{"get", "list", "watch", "create"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"nodes"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"serviceaccounts", "secrets", "configmaps", "services"},
+		Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+	},
+	{
+		APIGroups: []string{"apps"},
+		Resources: []string{"deployments", "daemonsets"},
+		Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+	},
+	{
+		APIGroups: []string{rbacv1.GroupName},
+		Resources: []string{"clusterroles", "clusterrolebindings", "roles", "rolebindings"},
+		Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+	},
+	{
+		APIGroups:     []string{rbacv1.GroupName},
+		Resources:     []string{"clusterroles"},
+		Verbs:         []string{"bind", "escalate"},
+		ResourceNames: []string{rancherAgentClusterRole, rancherProxyClusterRole},
+	},
+	{
+		NonResourceURLs: []string{"/version", "/healthz"},
+		Verbs:           []string{"get"},
+	},
+}
+
+// ServiceAccount is the service account Rancher uses to connect to the managed cluster
+type ServiceAccount struct {
+	Name        string
+	Namespace   string
+	ClusterRole string
+	// Rules binds the service account to a Role with these rules in its own namespace, instead of to ClusterRole
+	Rules []rbacv1.PolicyRule
+	// TokenExpiration requests an expiring token with the TokenRequest API, instead of using a long-lived token secret
+	TokenExpiration time.Duration
+	// TokenRotation recreates the token secret when it is older than TokenRotation
+	TokenRotation time.Duration
+
+	Timeout         time.Duration
+	PollingInterval time.Duration
+}
+
+// NewServiceAccount creates a ServiceAccount with the default name, namespace and cluster role
+func NewServiceAccount() *ServiceAccount {
+	return &ServiceAccount{
+		Name:            DefaultServiceAccountName,
+		Namespace:       DefaultServiceAccountNamespace,
+		ClusterRole:     DefaultClusterRole,
+		Timeout:         defaultTokenTimeout,
+		PollingInterval: defaultTokenPollingInterval,
+	}
+}
+
+// TokenSecretName is the name of the long-lived token secret
+func (sa *ServiceAccount) TokenSecretName() string {
+	return sa.Name + "-token"
+}
+
+// Token reconciles the service account and its cluster role binding, and returns a bearer token for the service account
+func (sa *ServiceAccount) Token(ctx context.Context, ki kubernetes.Interface) (string, error) {
+	if err := sa.reconcileNamespace(ctx, ki); err != nil {
+		return "", err
+	}
+	serviceAccount, err := sa.reconcileServiceAccount(ctx, ki)
+	if err != nil {
+		return "", err
+	}
+	if len(sa.Rules) > 0 {
+		if err := sa.reconcileRole(ctx, ki); err != nil {
+			return "", err
+		}
+		if err := sa.reconcileRoleBinding(ctx, ki); err != nil {
+			return "", err
+		}
+	} else {
+		if sa.ClusterRole == RestrictedClusterRole {
+			if err := reconcileRestrictedClusterRole(ctx, ki); err != nil {
+				return "", err
+			}
+		}
+		if err := sa.reconcileClusterRoleBinding(ctx, ki); err != nil {
+			return "", err
+		}
+	}
+	if sa.TokenExpiration > 0 {
+		return sa.requestToken(ctx, ki)
+	}
+	return sa.secretToken(ctx, ki, serviceAccount)
+}
+
+// Delete removes the service account, its token secret and its role bindings
+func (sa *ServiceAccount) Delete(ctx context.Context, ki kubernetes.Interface) error {
+	if len(sa.Rules) > 0 {
+		if err := ignoreNotFound(ki.RbacV1().RoleBindings(sa.Namespace).Delete(ctx, sa.Name, metav1.DeleteOptions{})); err != nil {
+			return fmt.Errorf("error deleting role binding %s/%s: %v", sa.Namespace, sa.Name, err)
+		}
+		if err := ignoreNotFound(ki.RbacV1().Roles(sa.Namespace).Delete(ctx, sa.Name, metav1.DeleteOptions{})); err != nil {
+			return fmt.Errorf("error deleting role %s/%s: %v", sa.Namespace, sa.Name, err)
+		}
+		return sa.deleteServiceAccount(ctx, ki)
+	}
+	if err := ignoreNotFound(ki.RbacV1().ClusterRoleBindings().Delete(ctx, sa.Name, metav1.DeleteOptions{})); err != nil {
+		return fmt.Errorf("error deleting cluster role binding %s: %v", sa.Name, err)
+	}
+	if sa.ClusterRole == RestrictedClusterRole {
+		if err := ignoreNotFound(ki.RbacV1().ClusterRoles().Delete(ctx, RestrictedClusterRole, metav1.DeleteOptions{})); err != nil {
+			return fmt.Errorf("error deleting cluster role %s: %v", RestrictedClusterRole, err)
+		}
+	}
+	return sa.deleteServiceAccount(ctx, ki)
+}
+
+// DeleteStale removes what the previous service account configuration left behind, after the service account moved namespace or changed cluster role.
+// The cluster role binding has the same name in both configurations, so it is updated rather than deleted.
+func (sa *ServiceAccount) DeleteStale(ctx context.Context, ki kubernetes.Interface, previous *ServiceAccount) error {
+	if previous.Namespace != sa.Namespace {
+		if err := previous.deleteServiceAccount(ctx, ki); err != nil {
+			return err
+		}
+	}
+	if previous.ClusterRole == RestrictedClusterRole && sa.ClusterRole != RestrictedClusterRole {
+		if err := ignoreNotFound(ki.RbacV1().ClusterRoles().Delete(ctx, RestrictedClusterRole, metav1.DeleteOptions{})); err != nil {
+			return fmt.Errorf("error deleting cluster role %s: %v", RestrictedClusterRole, err)
+		}
+	}
+	return nil
+}
+
+func (sa *ServiceAccount) deleteServiceAccount(ctx context.Context, ki kubernetes.Interface) error {
+	if err := ignoreNotFound(ki.CoreV1().Secrets(sa.Namespace).Delete(ctx, sa.TokenSecretName(), metav1.DeleteOptions{})); err != nil {
+		return fmt.Errorf("error deleting secret %s/%s: %v", sa.Namespace, sa.TokenSecretName(), err)
+	}
+	if err := ignoreNotFound(ki.CoreV1().ServiceAccounts(sa.Namespace).Delete(ctx, sa.Name, metav1.DeleteOptions{})); err != nil {
+		return fmt.Errorf("error deleting service account %s/%s: %v", sa.Namespace, sa.Name, err)
+	}
+	return nil
+}
+
+func ignoreNotFound(err error) error {
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (sa *ServiceAccount) reconcileNamespace(ctx context.Context, ki kubernetes.Interface) error {
+	_, err := ki.CoreV1().Namespaces().Get(ctx, sa.Namespace, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+	_, err = ki.CoreV1().Namespaces().Create(ctx, &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: sa.Namespace,
+		},
+	}, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+func reconcileRestrictedClusterRole(ctx context.Context, ki kubernetes.Interface) error {
+	current, err := ki.RbacV1().ClusterRoles().Get(ctx, RestrictedClusterRole, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error getting cluster role: %v", err)
+		}
+		_, err = ki.RbacV1().ClusterRoles().Create(ctx, &rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: RestrictedClusterRole,
+			},
+			Rules: restrictedClusterRoleRules,
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if !reflect.DeepEqual(current.Rules, restrictedClusterRoleRules) {
+		current.Rules = restrictedClusterRoleRules
+		_, err = ki.RbacV1().ClusterRoles().Update(ctx, current, metav1.UpdateOptions{})
+		return err
+	}
+	return nil
+}
+
+func (sa *ServiceAccount) reconcileRole(ctx context.Context, ki kubernetes.Interface) error {
+	current, err := ki.RbacV1().Roles(sa.Namespace).Get(ctx, sa.Name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error getting role: %v", err)
+		}
+		_, err = ki.RbacV1().Roles(sa.Namespace).Create(ctx, &rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      sa.Name,
+				Namespace: sa.Namespace,
+			},
+			Rules: sa.Rules,
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if !reflect.DeepEqual(current.Rules, sa.Rules) {
+		current.Rules = sa.Rules
+		_, err = ki.RbacV1().Roles(sa.Namespace).Update(ctx, current, metav1.UpdateOptions{})
+		return err
+	}
+	return nil
+}
+
+func (sa *ServiceAccount) reconcileRoleBinding(ctx context.Context, ki kubernetes.Interface) error {
+	desired := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      sa.Name,
+			Namespace: sa.Namespace,
+		},
+		Subjects: []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, APIGroup: "", Name: sa.Name, Namespace: sa.Namespace}},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     sa.Name,
+		},
+	}
+	current, err := ki.RbacV1().RoleBindings(sa.Namespace).Get(ctx, desired.Name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error getting role binding: %v", err)
+		}
+		_, err = ki.RbacV1().RoleBindings(sa.Namespace).Create(ctx, desired, metav1.CreateOptions{})
+		return err
+	}
+	if !reflect.DeepEqual(current.Subjects, desired.Subjects) || !reflect.DeepEqual(current.RoleRef, desired.RoleRef) {
+		// the role of a binding cannot be changed, so the binding is recreated
+		if err := ignoreNotFound(ki.RbacV1().RoleBindings(sa.Namespace).Delete(ctx, current.Name, metav1.DeleteOptions{})); err != nil {
+			return err
+		}
+		_, err = ki.RbacV1().RoleBindings(sa.Namespace).Create(ctx, desired, metav1.CreateOptions{})
+		return err
+	}
+	return nil
+}
+
+func (sa *ServiceAccount) reconcileServiceAccount(ctx context.Context, ki kubernetes.Interface) (*v1.ServiceAccount, error) {
+	serviceAccount, err := ki.CoreV1().ServiceAccounts(sa.Namespace).Get(ctx, sa.Name, metav1.GetOptions{})
+	if err == nil {
+		return serviceAccount, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	return ki.CoreV1().ServiceAccounts(sa.Namespace).Create(ctx, &v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      sa.Name,
+			Namespace: sa.Namespace,
+		},
+	}, metav1.CreateOptions{})
+}
+
+func (sa *ServiceAccount) reconcileClusterRoleBinding(ctx context.Context, ki kubernetes.Interface) error {
+	desired := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: sa.Name,
+		},
+		Subjects: []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, APIGroup: "", Name: sa.Name, Namespace: sa.Namespace}},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     sa.ClusterRole,
+		},
+	}
+	current, err := ki.RbacV1().ClusterRoleBindings().Get(ctx, desired.Name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error getting cluster role binding: %v", err)
+		}
+		_, err = ki.RbacV1().ClusterRoleBindings().Create(ctx, desired, metav1.CreateOptions{})
+		return err
+	}
+
+	// the role of a binding cannot be changed, so the binding is recreated
+	if current.RoleRef.Kind != desired.RoleRef.Kind || current.RoleRef.Name != desired.RoleRef.Name {
+		if err := ki.RbacV1().ClusterRoleBindings().Delete(ctx, current.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		_, err = ki.RbacV1().ClusterRoleBindings().Create(ctx, desired, metav1.CreateOptions{})
+		return err
+	}
+	if !reflect.DeepEqual(current.Subjects, desired.Subjects) {
+		current.Subjects = desired.Subjects
+		_, err = ki.RbacV1().ClusterRoleBindings().Update(ctx, current, metav1.UpdateOptions{})
+		return err
+	}
+	return nil
+}
+
+// requestToken creates an expiring token with the TokenRequest API
+func (sa *ServiceAccount) requestToken(ctx context.Context, ki kubernetes.Interface) (string, error) {
+	expirationSeconds := int64(sa.TokenExpiration.Seconds())
+	tokenRequest, err := ki.CoreV1().ServiceAccounts(sa.Namespace).CreateToken(ctx, sa.Name, &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			ExpirationSeconds: &expirationSeconds,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("error requesting token for service account %s/%s: %v", sa.Namespace, sa.Name, err)
+	}
+	return tokenRequest.Status.Token, nil
+}
+
+// secretToken creates a long-lived token secret, and waits for the token controller to populate it
+func (sa *ServiceAccount) secretToken(ctx context.Context, ki kubernetes.Interface, serviceAccount *v1.ServiceAccount) (string, error) {
+	secrets := ki.CoreV1().Secrets(sa.Namespace)
+	current, err := secrets.Get(ctx, sa.TokenSecretName(), metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return "", err
+		}
+		current = nil
+	}
+	if current != nil && sa.TokenRotation > 0 && time.Since(current.CreationTimestamp.Time) > sa.TokenRotation {
+		// deleting the secret revokes the token
+		if err := secrets.Delete(ctx, current.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return "", err
+		}
+		current = nil
+	}
+
+	if current == nil {
+		_, err = secrets.Create(ctx, &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      sa.TokenSecretName(),
+				Namespace: sa.Namespace,
+				OwnerReferences: []metav1.OwnerReference{
+					{
+						APIVersion: "v1",
+						Kind:       "ServiceAccount",
+						Name:       serviceAccount.Name,
+						UID:        serviceAccount.UID,
+					},
+				},
+				Annotations: map[string]string{
+					v1.ServiceAccountNameKey: serviceAccount.Name,
+				},
+			},
+			Type: v1.SecretTypeServiceAccountToken,
+		}, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return "", err
+		}
+	}
+
+	var token string
+	err = wait.PollImmediateWithContext(ctx, sa.PollingInterval, sa.Timeout, func(ctx context.Context) (bool, error) {
+		secret, err := secrets.Get(ctx, sa.TokenSecretName(), metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		token = string(secret.Data[v1.ServiceAccountTokenKey])
+		return len(token) > 0, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error getting authentication token from secret %s/%s: %v", sa.Namespace, sa.TokenSecretName(), err)
+	}
+	return token, nil
+}
@@ -0,0 +1,313 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package k8s
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"testing"
+	"time"
+)
+
+func createTestTokenSecret(token string, age time.Duration) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              DefaultServiceAccountName + "-token",
+			Namespace:         DefaultServiceAccountNamespace,
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+		},
+		Type: v1.SecretTypeServiceAccountToken,
+		Data: map[string][]byte{
+			v1.ServiceAccountTokenKey: []byte(token),
+		},
+	}
+}
+
+// populateTokens fills in the token of created token secrets, like the token controller
+func populateTokens(ki *fake.Clientset, token string) {
+	ki.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		secret := action.(k8stesting.CreateAction).GetObject().(*v1.Secret)
+		secret.Data = map[string][]byte{
+			v1.ServiceAccountTokenKey: []byte(token),
+		}
+		return false, nil, nil
+	})
+}
+
+func TestServiceAccountToken(t *testing.T) {
+	var tests = []struct {
+		name            string
+		objects         []runtime.Object
+		populate        bool
+		tokenExpiration time.Duration
+		tokenRotation   time.Duration
+		token           string
+		err             string
+	}{
+		{
+			"token secret populated",
+			nil,
+			true,
+			0,
+			0,
+			"new",
+			"",
+		},
+		{
+			"token secret exists",
+			[]runtime.Object{createTestTokenSecret("old", 48*time.Hour)},
+			true,
+			0,
+			0,
+			"old",
+			"",
+		},
+		{
+			"token secret rotated",
+			[]runtime.Object{createTestTokenSecret("old", 48*time.Hour)},
+			true,
+			0,
+			24 * time.Hour,
+			"new",
+			"",
+		},
+		{
+			"token secret not due for rotation",
+			[]runtime.Object{createTestTokenSecret("old", time.Hour)},
+			true,
+			0,
+			24 * time.Hour,
+			"old",
+			"",
+		},
+		{
+			"token secret never populated",
+			nil,
+			false,
+			0,
+			0,
+			"",
+			"error getting authentication token from secret default/kontainer-engine-olcne-token: timed out waiting for the condition",
+		},
+		{
+			"token request",
+			nil,
+			false,
+			time.Hour,
+			0,
+			"requested",
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			ki := fake.NewSimpleClientset(tt.objects...)
+			if tt.populate {
+				populateTokens(ki, "new")
+			}
+			var expirationSeconds int64
+			ki.PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if action.GetSubresource() != "token" {
+					return false, nil, nil
+				}
+				tokenRequest := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenRequest)
+				expirationSeconds = *tokenRequest.Spec.ExpirationSeconds
+				tokenRequest.Status.Token = "requested"
+				return true, tokenRequest, nil
+			})
+
+			sa := NewServiceAccount()
+			sa.TokenExpiration = tt.tokenExpiration
+			sa.TokenRotation = tt.tokenRotation
+			sa.Timeout = 50 * time.Millisecond
+			sa.PollingInterval = 10 * time.Millisecond
+			token, err := sa.Token(ctx, ki)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.token, token)
+			assert.Equal(t, int64(tt.tokenExpiration.Seconds()), expirationSeconds)
+
+			_, err = ki.CoreV1().ServiceAccounts(sa.Namespace).Get(ctx, sa.Name, metav1.GetOptions{})
+			assert.NoError(t, err)
+			crb, err := ki.RbacV1().ClusterRoleBindings().Get(ctx, sa.Name, metav1.GetOptions{})
+			assert.NoError(t, err)
+			assert.Equal(t, DefaultClusterRole, crb.RoleRef.Name)
+		})
+	}
+}
+
+func TestReconcileClusterRoleBinding(t *testing.T) {
+	subject := rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Name: DefaultServiceAccountName, Namespace: DefaultServiceAccountNamespace}
+	var tests = []struct {
+		name    string
+		current *rbacv1.ClusterRoleBinding
+	}{
+		{
+			"create",
+			nil,
+		},
+		{
+			"role changed",
+			&rbacv1.ClusterRoleBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: DefaultServiceAccountName},
+				Subjects:   []rbacv1.Subject{subject},
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "view"},
+			},
+		},
+		{
+			"subjects changed",
+			&rbacv1.ClusterRoleBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: DefaultServiceAccountName},
+				Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "other", Namespace: "other"}},
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: DefaultClusterRole},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			ki := fake.NewSimpleClientset()
+			if tt.current != nil {
+				ki = fake.NewSimpleClientset(tt.current)
+			}
+			sa := NewServiceAccount()
+			assert.NoError(t, sa.reconcileClusterRoleBinding(ctx, ki))
+
+			crb, err := ki.RbacV1().ClusterRoleBindings().Get(ctx, sa.Name, metav1.GetOptions{})
+			assert.NoError(t, err)
+			assert.Equal(t, DefaultClusterRole, crb.RoleRef.Name)
+			assert.Equal(t, []rbacv1.Subject{subject}, crb.Subjects)
+		})
+	}
+}
+
+func TestServiceAccountRestrictedRoleAndNamespace(t *testing.T) {
+	ctx := context.TODO()
+	ki := fake.NewSimpleClientset()
+	populateTokens(ki, "new")
+	sa := NewServiceAccount()
+	sa.Namespace = "rancher-access"
+	sa.ClusterRole = RestrictedClusterRole
+
+	token, err := sa.Token(ctx, ki)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", token)
+	_, err = ki.CoreV1().Namespaces().Get(ctx, sa.Namespace, metav1.GetOptions{})
+	assert.NoError(t, err)
+	role, err := ki.RbacV1().ClusterRoles().Get(ctx, RestrictedClusterRole, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, restrictedClusterRoleRules, role.Rules)
+	// binding or escalating to any other role, like cluster-admin, is not allowed
+	for _, rule := range role.Rules {
+		for _, verb := range rule.Verbs {
+			if verb == "bind" || verb == "escalate" || verb == "*" {
+				assert.ElementsMatch(t, []string{rancherAgentClusterRole, rancherProxyClusterRole}, rule.ResourceNames)
+			}
+		}
+	}
+	crb, err := ki.RbacV1().ClusterRoleBindings().Get(ctx, sa.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, RestrictedClusterRole, crb.RoleRef.Name)
+	assert.Equal(t, sa.Namespace, crb.Subjects[0].Namespace)
+
+	assert.NoError(t, sa.Delete(ctx, ki))
+	_, err = ki.CoreV1().ServiceAccounts(sa.Namespace).Get(ctx, sa.Name, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = ki.CoreV1().Secrets(sa.Namespace).Get(ctx, sa.TokenSecretName(), metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = ki.RbacV1().ClusterRoleBindings().Get(ctx, sa.Name, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = ki.RbacV1().ClusterRoles().Get(ctx, RestrictedClusterRole, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	// deleting twice is not an error
+	assert.NoError(t, sa.Delete(ctx, ki))
+}
+
+func TestServiceAccountDeleteStale(t *testing.T) {
+	ctx := context.TODO()
+	ki := fake.NewSimpleClientset()
+	populateTokens(ki, "new")
+	previous := NewServiceAccount()
+	previous.ClusterRole = RestrictedClusterRole
+	_, err := previous.Token(ctx, ki)
+	assert.NoError(t, err)
+
+	sa := NewServiceAccount()
+	sa.Namespace = "rancher-access"
+	_, err = sa.Token(ctx, ki)
+	assert.NoError(t, err)
+	assert.NoError(t, sa.DeleteStale(ctx, ki, previous))
+
+	_, err = ki.CoreV1().ServiceAccounts(previous.Namespace).Get(ctx, previous.Name, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = ki.CoreV1().Secrets(previous.Namespace).Get(ctx, previous.TokenSecretName(), metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = ki.RbacV1().ClusterRoles().Get(ctx, RestrictedClusterRole, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = ki.CoreV1().ServiceAccounts(sa.Namespace).Get(ctx, sa.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	crb, err := ki.RbacV1().ClusterRoleBindings().Get(ctx, sa.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultClusterRole, crb.RoleRef.Name)
+	assert.Equal(t, sa.Namespace, crb.Subjects[0].Namespace)
+}
+
+func TestServiceAccountRules(t *testing.T) {
+	ctx := context.TODO()
+	ki := fake.NewSimpleClientset()
+	populateTokens(ki, "token")
+	sa := NewServiceAccount()
+	sa.Namespace = "cluster-ns"
+	sa.Rules = []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{"cluster.x-k8s.io"},
+			Resources: []string{"machinedeployments"},
+			Verbs:     []string{"get"},
+		},
+	}
+	token, err := sa.Token(ctx, ki)
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	role, err := ki.RbacV1().Roles(sa.Namespace).Get(ctx, sa.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, sa.Rules, role.Rules)
+	binding, err := ki.RbacV1().RoleBindings(sa.Namespace).Get(ctx, sa.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "Role", binding.RoleRef.Kind)
+	assert.Equal(t, sa.Name, binding.RoleRef.Name)
+	// the service account is not bound to a cluster role
+	_, err = ki.RbacV1().ClusterRoleBindings().Get(ctx, sa.Name, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// changed rules are updated
+	sa.Rules[0].Verbs = []string{"get", "list"}
+	_, err = sa.Token(ctx, ki)
+	assert.NoError(t, err)
+	role, err = ki.RbacV1().Roles(sa.Namespace).Get(ctx, sa.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"get", "list"}, role.Rules[0].Verbs)
+
+	assert.NoError(t, sa.Delete(ctx, ki))
+	_, err = ki.RbacV1().Roles(sa.Namespace).Get(ctx, sa.Name, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = ki.RbacV1().RoleBindings(sa.Namespace).Get(ctx, sa.Name, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = ki.CoreV1().ServiceAccounts(sa.Namespace).Get(ctx, sa.Name, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
@@ -10,8 +10,10 @@ import (
 )
 
 type Client struct {
-	Images  map[string]string
-	Subnets map[string]*core.Subnet
+	Images                map[string]string
+	Subnets               map[string]*core.Subnet
+	VCNs                  map[string]*core.Vcn
+	NetworkSecurityGroups map[string]*core.NetworkSecurityGroup
 }
 
 // GetImageIdByName retrieves an image OCID given an image name and a compartment id, if that image exists.
@@ -31,3 +33,21 @@ func (c *Client) GetSubnetById(ctx context.Context, subnetId string) (*core.Subn
 	}
 	return subnet, nil
 }
+
+// GetVCNById retrieves a VCN given that VCN's Id.
+func (c *Client) GetVCNById(ctx context.Context, vcnId string) (*core.Vcn, error) {
+	vcn, ok := c.VCNs[vcnId]
+	if !ok {
+		return nil, fmt.Errorf("no VCN found for %s", vcnId)
+	}
+	return vcn, nil
+}
+
+// GetNetworkSecurityGroupById retrieves a network security group given that network security group's Id.
+func (c *Client) GetNetworkSecurityGroupById(ctx context.Context, nsgId string) (*core.NetworkSecurityGroup, error) {
+	nsg, ok := c.NetworkSecurityGroups[nsgId]
+	if !ok {
+		return nil, fmt.Errorf("no network security group found for %s", nsgId)
+	}
+	return nsg, nil
+}
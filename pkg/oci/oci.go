@@ -18,7 +18,9 @@ const (
 // Client interface for OCI Clients
 type Client interface {
 	GetSubnetById(context.Context, string) (*core.Subnet, error)
+	GetVCNById(context.Context, string) (*core.Vcn, error)
 	GetImageIdByName(ctx context.Context, displayName, compartmentId string) (string, error)
+	GetNetworkSecurityGroupById(context.Context, string) (*core.NetworkSecurityGroup, error)
 }
 
 // ClientImpl OCI Client implementation
@@ -74,6 +76,34 @@ func (c *ClientImpl) GetSubnetById(ctx context.Context, subnetId string) (*core.
 	return &subnet, nil
 }
 
+// GetVCNById retrieves a VCN given that VCN's Id.
+func (c *ClientImpl) GetVCNById(ctx context.Context, vcnId string) (*core.Vcn, error) {
+	response, err := c.vnClient.GetVcn(ctx, core.GetVcnRequest{
+		VcnId:           &vcnId,
+		RequestMetadata: common.RequestMetadata{},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	vcn := response.Vcn
+	return &vcn, nil
+}
+
+// GetNetworkSecurityGroupById retrieves a network security group given that network security group's Id.
+func (c *ClientImpl) GetNetworkSecurityGroupById(ctx context.Context, nsgId string) (*core.NetworkSecurityGroup, error) {
+	response, err := c.vnClient.GetNetworkSecurityGroup(ctx, core.GetNetworkSecurityGroupRequest{
+		NetworkSecurityGroupId: &nsgId,
+		RequestMetadata:        common.RequestMetadata{},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	nsg := response.NetworkSecurityGroup
+	return &nsg, nil
+}
+
 // SubnetAccess returns public or private, depending on a subnet's access type
 func SubnetAccess(subnet core.Subnet) string {
 	if subnet.ProhibitPublicIpOnVnic != nil && subnet.ProhibitInternetIngress != nil && !*subnet.ProhibitPublicIpOnVnic && !*subnet.ProhibitInternetIngress {
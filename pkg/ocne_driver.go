@@ -5,20 +5,18 @@ package pkg
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/rancher/kontainer-engine/types"
 	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/capi"
 	driverconst "github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/constants"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/etcd"
 	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/k8s"
 	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/variables"
 	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/version"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
-	v1 "k8s.io/api/core/v1"
-	rbacv1 "k8s.io/api/rbac/v1"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"time"
 )
@@ -43,13 +41,15 @@ func NewDriver() types.Driver {
 	driver.driverCapabilities.AddCapability(types.SetVersionCapability)
 	driver.driverCapabilities.AddCapability(types.GetClusterSizeCapability)
 	driver.driverCapabilities.AddCapability(types.SetClusterSizeCapability)
+	driver.driverCapabilities.AddCapability(types.EtcdBackupCapability)
 
 	return driver
 }
 
 func (d *OCIOCNEDriver) Remove(ctx context.Context, info *types.ClusterInfo) error {
 	d.Logger.Infof("capi.driver.Remove(...) called")
-	state, err := d.loadVariables(info)
+	// removal does not use the cloud credential, so clusters can be removed after their credential is deleted
+	state, err := d.loadState(info)
 	if err != nil {
 		return err
 	}
@@ -61,6 +61,14 @@ func (d *OCIOCNEDriver) Remove(ctx context.Context, info *types.ClusterInfo) err
 	if err != nil {
 		return fmt.Errorf("failed to managed cluster dynamic client: %v", err)
 	}
+	managedKi, err := k8s.NewInterfaceForKubeconfig(managedClusterKubeConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create managed cluster client: %v", err)
+	}
+	// the cluster is deleted regardless, so a failure to clean up the service account does not block removal
+	if err := d.deleteServiceAccount(ctx, managedKi, state); err != nil {
+		d.Logger.Warnf("failed to delete service account on cluster %s: %v", state.Name, err)
+	}
 	adminDi, err := k8s.InjectedDynamic()
 	if err != nil {
 		return fmt.Errorf("failed to created admin cluster dynamic client: %v", err)
@@ -71,9 +79,9 @@ func (d *OCIOCNEDriver) Remove(ctx context.Context, info *types.ClusterInfo) err
 	}
 	capiClient := d.NewCAPIClient()
 	if err := capiClient.DeleteVerrazzanoResources(ctx, managedDi, adminDi, state); err != nil {
-		return err
+		return d.logProgress(state.Name, err)
 	}
-	return capiClient.DeleteCluster(ctx, adminDi, adminKi, state)
+	return d.logProgress(state.Name, capiClient.DeleteCluster(ctx, adminDi, adminKi, state))
 }
 
 // GetDriverCreateOptions implements driver interface
@@ -146,6 +154,13 @@ func (d *OCIOCNEDriver) GetDriverCreateOptions(ctx context.Context) (*types.Driv
 			DefaultBool: true,
 		},
 	}
+	driverFlag.Options[driverconst.InstallClusterAutoscaler] = &types.Flag{
+		Type:  types.BoolType,
+		Usage: "Install the cluster autoscaler for node pools with minReplicas and maxReplicas. The admin cluster API server must be reachable from the managed cluster",
+		Default: &types.Default{
+			DefaultBool: false,
+		},
+	}
 	driverFlag.Options[driverconst.VerrazzanoVersion] = &types.Flag{
 		Type:  types.StringType,
 		Usage: "The Verrazzano Version",
@@ -178,6 +193,54 @@ func (d *OCIOCNEDriver) GetDriverCreateOptions(ctx context.Context) (*types.Driv
 			DefaultBool: false,
 		},
 	}
+	driverFlag.Options[driverconst.PrivateCluster] = &types.Flag{
+		Type:  types.BoolType,
+		Usage: "Create a cluster without public subnets or public IPs",
+		Default: &types.Default{
+			DefaultBool: false,
+		},
+	}
+	driverFlag.Options[driverconst.APIServerCIDRs] = &types.Flag{
+		Type:  types.StringSliceType,
+		Usage: "CIDR blocks allowed to reach the Quick Create Kubernetes API endpoint, defaults to anywhere, or the allowed CIDRs of a private cluster. The VCN CIDR is always allowed",
+		Default: &types.Default{
+			DefaultStringSlice: &types.StringSlice{Value: []string{}}, // avoid nil value for init
+		},
+	}
+	driverFlag.Options[driverconst.SSHCIDRs] = &types.Flag{
+		Type:  types.StringSliceType,
+		Usage: "CIDR blocks allowed to SSH to Quick Create nodes, or none to disable SSH. Defaults to anywhere, or the allowed CIDRs of a private cluster",
+		Default: &types.Default{
+			DefaultStringSlice: &types.StringSlice{Value: []string{}}, // avoid nil value for init
+		},
+	}
+	driverFlag.Options[driverconst.AllowedCIDRs] = &types.Flag{
+		Type:  types.StringSliceType,
+		Usage: "CIDR blocks allowed to reach the Kubernetes API endpoint and SSH of a private Quick Create cluster, defaults to the VCN CIDR. The API endpoint always allows the VCN CIDR",
+		Default: &types.Default{
+			DefaultStringSlice: &types.StringSlice{Value: []string{}}, // avoid nil value for init
+		},
+	}
+	driverFlag.Options[driverconst.VcnCIDR] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "The CIDR block of the Quick Create VCN, defaults to the cluster CIDR",
+	}
+	driverFlag.Options[driverconst.ControlPlaneSubnetPrefixLength] = &types.Flag{
+		Type:  types.IntType,
+		Usage: "The prefix length of the Quick Create control plane subnet, default 29",
+	}
+	driverFlag.Options[driverconst.ControlPlaneEndpointSubnetPrefixLength] = &types.Flag{
+		Type:  types.IntType,
+		Usage: "The prefix length of the Quick Create control plane endpoint subnet, default 29",
+	}
+	driverFlag.Options[driverconst.LoadBalancerSubnetPrefixLength] = &types.Flag{
+		Type:  types.IntType,
+		Usage: "The prefix length of the Quick Create service load balancer subnet, default 27",
+	}
+	driverFlag.Options[driverconst.WorkerSubnetPrefixLength] = &types.Flag{
+		Type:  types.IntType,
+		Usage: "The prefix length of the Quick Create worker subnet, default 20 or a quarter of the VCN",
+	}
 	driverFlag.Options[driverconst.KubernetesVersion] = &types.Flag{
 		Type:  types.StringType,
 		Usage: "The Kubernetes version that will be used for your master and worker nodes e.g. v1.11.9, v1.12.7",
@@ -213,6 +276,13 @@ func (d *OCIOCNEDriver) GetDriverCreateOptions(ctx context.Context) (*types.Driv
 			DefaultString: defaults.ContainerImages.TigeraOperator,
 		},
 	}
+	driverFlag.Options[driverconst.AllowCustomImageTags] = &types.Flag{
+		Type:  types.BoolType,
+		Usage: "Allow the OCNE version and image tags to differ from the OCNE version mapping when upgrading Kubernetes",
+		Default: &types.Default{
+			DefaultBool: false,
+		},
+	}
 	driverFlag.Options[driverconst.ControlPlaneOCPUs] = &types.Flag{
 		Type:  types.IntType,
 		Usage: "Optional number of OCPUs for control plane nodes",
@@ -238,6 +308,74 @@ func (d *OCIOCNEDriver) GetDriverCreateOptions(ctx context.Context) (*types.Driv
 		Type:  types.StringType,
 		Usage: "The contents of the SSH public key to use for the nodes",
 	}
+	driverFlag.Options[driverconst.ControlPlaneMachineHealthCheck] = &types.Flag{
+		Type:  types.BoolType,
+		Usage: "Create a MachineHealthCheck to remediate unhealthy control plane nodes",
+		Default: &types.Default{
+			DefaultBool: false,
+		},
+	}
+	driverFlag.Options[driverconst.MachineHealthCheckMaxUnhealthy] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "The number or percentage of unhealthy nodes above which MachineHealthChecks stop remediating nodes",
+		Default: &types.Default{
+			DefaultString: variables.DefaultMachineHealthCheckMaxUnhealthy,
+		},
+	}
+	driverFlag.Options[driverconst.MachineHealthCheckNodeStartupTimeout] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "How long MachineHealthChecks wait for a node to join the cluster before remediating it",
+		Default: &types.Default{
+			DefaultString: variables.DefaultMachineHealthCheckNodeStartupTimeout,
+		},
+	}
+	driverFlag.Options[driverconst.MachineHealthCheckUnhealthyTimeout] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "How long a node may be not ready before MachineHealthChecks remediate it",
+		Default: &types.Default{
+			DefaultString: variables.DefaultMachineHealthCheckUnhealthyTimeout,
+		},
+	}
+	driverFlag.Options[driverconst.ControlPlaneMaxSurge] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "Number of control plane nodes created before old nodes are removed during a rollout, 0 or 1. 0 requires at least 3 control plane nodes",
+		Default: &types.Default{
+			DefaultString: variables.DefaultControlPlaneMaxSurge,
+		},
+	}
+	driverFlag.Options[driverconst.ControlPlaneRolloutAfter] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "Replace the control plane nodes after this RFC 3339 time",
+	}
+	driverFlag.Options[driverconst.ControlPlaneRolloutBeforeCertificatesExpiryDays] = &types.Flag{
+		Type:  types.IntType,
+		Usage: "Replace control plane nodes this many days before their certificates expire, at least 7. 0 disables certificate based rollouts",
+	}
+	driverFlag.Options[driverconst.NodePoolMaxSurge] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "Default number or percentage of nodes a node pool creates above its size during a rollout",
+		Default: &types.Default{
+			DefaultString: variables.DefaultNodePoolMaxSurge,
+		},
+	}
+	driverFlag.Options[driverconst.NodePoolMaxUnavailable] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "Default number or percentage of nodes in a node pool that may be unavailable during a rollout",
+		Default: &types.Default{
+			DefaultString: variables.DefaultNodePoolMaxUnavailable,
+		},
+	}
+	driverFlag.Options[driverconst.MinReadySeconds] = &types.Flag{
+		Type:  types.IntType,
+		Usage: "Default number of seconds a new node must be ready before it is considered available during a rollout",
+	}
+	driverFlag.Options[driverconst.NodeDrainTimeout] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "How long to drain a node before it is deleted, 0s waits without a time limit",
+		Default: &types.Default{
+			DefaultString: variables.DefaultNodeDrainTimeout,
+		},
+	}
 	driverFlag.Options[driverconst.NumControlPlaneNodes] = &types.Flag{
 		Type:  types.IntType,
 		Usage: "Number of control plane nodes, default 1",
@@ -253,6 +391,13 @@ func (d *OCIOCNEDriver) GetDriverCreateOptions(ctx context.Context) (*types.Driv
 		Type:  types.StringType,
 		Usage: "The cloud credential id",
 	}
+	driverFlag.Options[driverconst.AuthMode] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "How to authenticate with OCI: UserPrincipal uses the cloud credential API key, InstancePrincipal and WorkloadIdentity authenticate the admin cluster as an OCI instance or OKE workload, and the managed cluster nodes as OCI instances",
+		Default: &types.Default{
+			DefaultString: variables.AuthModeUserPrincipal,
+		},
+	}
 	driverFlag.Options[driverconst.Region] = &types.Flag{
 		Type:  types.StringType,
 		Usage: "The cloud provider region",
@@ -295,6 +440,22 @@ func (d *OCIOCNEDriver) GetDriverCreateOptions(ctx context.Context) (*types.Driv
 		Type:  types.StringType,
 		Usage: "OCID for load balancer subnet",
 	}
+	driverFlag.Options[driverconst.ControlPlaneEndpointSubnet] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "OCID for the control plane endpoint subnet, defaults to the control plane subnet (Optional)",
+	}
+	driverFlag.Options[driverconst.ControlPlaneNSG] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "OCID for the control plane network security group of an existing VCN (Optional)",
+	}
+	driverFlag.Options[driverconst.ControlPlaneEndpointNSG] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "OCID for the control plane endpoint network security group of an existing VCN (Optional)",
+	}
+	driverFlag.Options[driverconst.WorkerNodeNSG] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "OCID for the node pool network security group of an existing VCN (Optional)",
+	}
 	driverFlag.Options[driverconst.PreOCNECommands] = &types.Flag{
 		Type:  types.StringSliceType,
 		Usage: "Commands to run before OCNE initialization",
@@ -316,6 +477,13 @@ func (d *OCIOCNEDriver) GetDriverCreateOptions(ctx context.Context) (*types.Driv
 			DefaultStringSlice: &types.StringSlice{Value: []string{}}, // avoid nil value for init
 		},
 	}
+	driverFlag.Options[driverconst.NodePoolScalingPolicy] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "How cluster resizes are distributed across node pools: first, proportional, or scalable",
+		Default: &types.Default{
+			DefaultString: variables.DefaultScalingPolicy,
+		},
+	}
 	driverFlag.Options[driverconst.ApplyYAMLs] = &types.Flag{
 		Type:  types.StringSliceType,
 		Usage: "YAMLs to apply on managed cluster",
@@ -323,6 +491,61 @@ func (d *OCIOCNEDriver) GetDriverCreateOptions(ctx context.Context) (*types.Driv
 			DefaultStringSlice: &types.StringSlice{Value: []string{}}, // avoid nil value for init
 		},
 	}
+	driverFlag.Options[driverconst.ServiceAccountTokenExpirationHours] = &types.Flag{
+		Type:  types.IntType,
+		Usage: "If set, Rancher uses an expiring service account token with this lifetime in hours, renewed each time the cluster is checked. By default, a long-lived token secret is used",
+		Default: &types.Default{
+			DefaultInt: 0,
+		},
+	}
+	driverFlag.Options[driverconst.ServiceAccountTokenRotationHours] = &types.Flag{
+		Type:  types.IntType,
+		Usage: "If set, the long-lived service account token secret is recreated when it is older than this many hours",
+		Default: &types.Default{
+			DefaultInt: 0,
+		},
+	}
+	driverFlag.Options[driverconst.ServiceAccountNamespace] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "The namespace of the service account Rancher uses to manage the cluster",
+		Default: &types.Default{
+			DefaultString: k8s.DefaultServiceAccountNamespace,
+		},
+	}
+	driverFlag.Options[driverconst.ServiceAccountClusterRole] = &types.Flag{
+		Type:  types.StringType,
+		Usage: fmt.Sprintf("The cluster role bound to the service account Rancher uses to manage the cluster. Use %s for a built-in role limited to deploying the Rancher agent. The Rancher agent is a cluster admin, so that role is admin-equivalent", k8s.RestrictedClusterRole),
+		Default: &types.Default{
+			DefaultString: k8s.DefaultClusterRole,
+		},
+	}
+	driverFlag.Options[driverconst.ETCDBackupS3Endpoint] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "The S3-compatible endpoint for etcd snapshots",
+	}
+	driverFlag.Options[driverconst.ETCDBackupS3Region] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "The region of the etcd snapshot bucket",
+	}
+	driverFlag.Options[driverconst.ETCDBackupS3Bucket] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "The bucket to store etcd snapshots in",
+	}
+	driverFlag.Options[driverconst.ETCDBackupS3Folder] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "Optional folder within the bucket to store etcd snapshots in",
+	}
+	driverFlag.Options[driverconst.ETCDBackupCredentialId] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "The namespace:name of the secret containing the accessKey and secretKey for the etcd snapshot bucket",
+	}
+	driverFlag.Options[driverconst.ETCDBackupHelperImage] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "Image used to upload and download etcd snapshots, must contain curl",
+		Default: &types.Default{
+			DefaultString: variables.DefaultETCDBackupHelperImage,
+		},
+	}
 
 	return &driverFlag, nil
 }
@@ -364,6 +587,102 @@ func (d *OCIOCNEDriver) GetDriverUpdateOptions(ctx context.Context) (*types.Driv
 			DefaultBool: true,
 		},
 	}
+	driverFlag.Options[driverconst.InstallClusterAutoscaler] = &types.Flag{
+		Type:  types.BoolType,
+		Usage: "Install the cluster autoscaler for node pools with minReplicas and maxReplicas. The admin cluster API server must be reachable from the managed cluster",
+		Default: &types.Default{
+			DefaultBool: false,
+		},
+	}
+	driverFlag.Options[driverconst.ControlPlaneMachineHealthCheck] = &types.Flag{
+		Type:  types.BoolType,
+		Usage: "Create a MachineHealthCheck to remediate unhealthy control plane nodes",
+		Default: &types.Default{
+			DefaultBool: false,
+		},
+	}
+	driverFlag.Options[driverconst.MachineHealthCheckMaxUnhealthy] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "The number or percentage of unhealthy nodes above which MachineHealthChecks stop remediating nodes",
+		Default: &types.Default{
+			DefaultString: variables.DefaultMachineHealthCheckMaxUnhealthy,
+		},
+	}
+	driverFlag.Options[driverconst.MachineHealthCheckNodeStartupTimeout] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "How long MachineHealthChecks wait for a node to join the cluster before remediating it",
+		Default: &types.Default{
+			DefaultString: variables.DefaultMachineHealthCheckNodeStartupTimeout,
+		},
+	}
+	driverFlag.Options[driverconst.MachineHealthCheckUnhealthyTimeout] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "How long a node may be not ready before MachineHealthChecks remediate it",
+		Default: &types.Default{
+			DefaultString: variables.DefaultMachineHealthCheckUnhealthyTimeout,
+		},
+	}
+	driverFlag.Options[driverconst.ControlPlaneMaxSurge] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "Number of control plane nodes created before old nodes are removed during a rollout, 0 or 1. 0 requires at least 3 control plane nodes",
+		Default: &types.Default{
+			DefaultString: variables.DefaultControlPlaneMaxSurge,
+		},
+	}
+	driverFlag.Options[driverconst.ControlPlaneRolloutAfter] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "Replace the control plane nodes after this RFC 3339 time",
+	}
+	driverFlag.Options[driverconst.ControlPlaneRolloutBeforeCertificatesExpiryDays] = &types.Flag{
+		Type:  types.IntType,
+		Usage: "Replace control plane nodes this many days before their certificates expire, at least 7. 0 disables certificate based rollouts",
+	}
+	driverFlag.Options[driverconst.NodePoolMaxSurge] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "Default number or percentage of nodes a node pool creates above its size during a rollout",
+		Default: &types.Default{
+			DefaultString: variables.DefaultNodePoolMaxSurge,
+		},
+	}
+	driverFlag.Options[driverconst.NodePoolMaxUnavailable] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "Default number or percentage of nodes in a node pool that may be unavailable during a rollout",
+		Default: &types.Default{
+			DefaultString: variables.DefaultNodePoolMaxUnavailable,
+		},
+	}
+	driverFlag.Options[driverconst.MinReadySeconds] = &types.Flag{
+		Type:  types.IntType,
+		Usage: "Default number of seconds a new node must be ready before it is considered available during a rollout",
+	}
+	driverFlag.Options[driverconst.NodeDrainTimeout] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "How long to drain a node before it is deleted, 0s waits without a time limit",
+		Default: &types.Default{
+			DefaultString: variables.DefaultNodeDrainTimeout,
+		},
+	}
+	driverFlag.Options[driverconst.APIServerCIDRs] = &types.Flag{
+		Type:  types.StringSliceType,
+		Usage: "CIDR blocks allowed to reach the Quick Create Kubernetes API endpoint, defaults to anywhere, or the allowed CIDRs of a private cluster. The VCN CIDR is always allowed",
+		Default: &types.Default{
+			DefaultStringSlice: &types.StringSlice{Value: []string{}}, // avoid nil value for init
+		},
+	}
+	driverFlag.Options[driverconst.SSHCIDRs] = &types.Flag{
+		Type:  types.StringSliceType,
+		Usage: "CIDR blocks allowed to SSH to Quick Create nodes, or none to disable SSH. Defaults to anywhere, or the allowed CIDRs of a private cluster",
+		Default: &types.Default{
+			DefaultStringSlice: &types.StringSlice{Value: []string{}}, // avoid nil value for init
+		},
+	}
+	driverFlag.Options[driverconst.AllowedCIDRs] = &types.Flag{
+		Type:  types.StringSliceType,
+		Usage: "CIDR blocks allowed to reach the Kubernetes API endpoint and SSH of a private Quick Create cluster, defaults to the VCN CIDR. The API endpoint always allows the VCN CIDR",
+		Default: &types.Default{
+			DefaultStringSlice: &types.StringSlice{Value: []string{}}, // avoid nil value for init
+		},
+	}
 	driverFlag.Options[driverconst.NumControlPlaneNodes] = &types.Flag{
 		Type:  types.IntType,
 		Usage: "Number of control plane nodes, default 1",
@@ -414,6 +733,13 @@ func (d *OCIOCNEDriver) GetDriverUpdateOptions(ctx context.Context) (*types.Driv
 			DefaultString: defaults.ContainerImages.TigeraOperator,
 		},
 	}
+	driverFlag.Options[driverconst.AllowCustomImageTags] = &types.Flag{
+		Type:  types.BoolType,
+		Usage: "Allow the OCNE version and image tags to differ from the OCNE version mapping when upgrading Kubernetes",
+		Default: &types.Default{
+			DefaultBool: false,
+		},
+	}
 	driverFlag.Options[driverconst.ControlPlaneOCPUs] = &types.Flag{
 		Type:  types.IntType,
 		Usage: "Optional number of OCPUs for control plane nodes",
@@ -446,6 +772,13 @@ func (d *OCIOCNEDriver) GetDriverUpdateOptions(ctx context.Context) (*types.Driv
 			DefaultStringSlice: &types.StringSlice{Value: []string{}}, // avoid nil value for init
 		},
 	}
+	driverFlag.Options[driverconst.NodePoolScalingPolicy] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "How cluster resizes are distributed across node pools: first, proportional, or scalable",
+		Default: &types.Default{
+			DefaultString: variables.DefaultScalingPolicy,
+		},
+	}
 	driverFlag.Options[driverconst.ApplyYAMLs] = &types.Flag{
 		Type:  types.StringSliceType,
 		Usage: "YAMLs to apply on managed cluster",
@@ -453,18 +786,74 @@ func (d *OCIOCNEDriver) GetDriverUpdateOptions(ctx context.Context) (*types.Driv
 			DefaultStringSlice: &types.StringSlice{Value: []string{}}, // avoid nil value for init
 		},
 	}
+	driverFlag.Options[driverconst.ServiceAccountTokenExpirationHours] = &types.Flag{
+		Type:  types.IntType,
+		Usage: "If set, Rancher uses an expiring service account token with this lifetime in hours, renewed each time the cluster is checked. By default, a long-lived token secret is used",
+		Default: &types.Default{
+			DefaultInt: 0,
+		},
+	}
+	driverFlag.Options[driverconst.ServiceAccountTokenRotationHours] = &types.Flag{
+		Type:  types.IntType,
+		Usage: "If set, the long-lived service account token secret is recreated when it is older than this many hours",
+		Default: &types.Default{
+			DefaultInt: 0,
+		},
+	}
+	driverFlag.Options[driverconst.ServiceAccountNamespace] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "The namespace of the service account Rancher uses to manage the cluster",
+		Default: &types.Default{
+			DefaultString: k8s.DefaultServiceAccountNamespace,
+		},
+	}
+	driverFlag.Options[driverconst.ServiceAccountClusterRole] = &types.Flag{
+		Type:  types.StringType,
+		Usage: fmt.Sprintf("The cluster role bound to the service account Rancher uses to manage the cluster. Use %s for a built-in role limited to deploying the Rancher agent. The Rancher agent is a cluster admin, so that role is admin-equivalent", k8s.RestrictedClusterRole),
+		Default: &types.Default{
+			DefaultString: k8s.DefaultClusterRole,
+		},
+	}
+	driverFlag.Options[driverconst.ETCDBackupS3Endpoint] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "The S3-compatible endpoint for etcd snapshots",
+	}
+	driverFlag.Options[driverconst.ETCDBackupS3Region] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "The region of the etcd snapshot bucket",
+	}
+	driverFlag.Options[driverconst.ETCDBackupS3Bucket] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "The bucket to store etcd snapshots in",
+	}
+	driverFlag.Options[driverconst.ETCDBackupS3Folder] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "Optional folder within the bucket to store etcd snapshots in",
+	}
+	driverFlag.Options[driverconst.ETCDBackupCredentialId] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "The namespace:name of the secret containing the accessKey and secretKey for the etcd snapshot bucket",
+	}
+	driverFlag.Options[driverconst.ETCDBackupHelperImage] = &types.Flag{
+		Type:  types.StringType,
+		Usage: "Image used to upload and download etcd snapshots, must contain curl",
+		Default: &types.Default{
+			DefaultString: variables.DefaultETCDBackupHelperImage,
+		},
+	}
 	return &driverFlag, nil
 }
 
 // Create implements driver interface
 func (d *OCIOCNEDriver) Create(ctx context.Context, opts *types.DriverOptions, _ *types.ClusterInfo) (*types.ClusterInfo, error) {
 	d.Logger.Infof("capi.driver.Create(...) called")
-	state, err := variables.NewFromOptions(ctx, opts)
-	if err != nil {
-		d.Logger.Errorf("error creating state %v", err)
+	state := variables.NewFromOptions(opts)
+	// every problem with the options is reported before any OCI lookup
+	if err := state.Validate(); err != nil {
 		return nil, err
 	}
-	if err != nil {
+	if err := state.SetDynamicValues(ctx); err != nil {
+		d.Logger.Errorf("error creating state %v", err)
 		return nil, err
 	}
 
@@ -472,8 +861,7 @@ func (d *OCIOCNEDriver) Create(ctx context.Context, opts *types.DriverOptions, _
 	* The ClusterInfo includes the following information Version, ServiceAccountToken,Endpoint, username, password, etc
 	 */
 	clusterInfo := &types.ClusterInfo{}
-	err = storeVariables(clusterInfo, state)
-	if err != nil {
+	if err := storeVariables(clusterInfo, state); err != nil {
 		d.Logger.Errorf("error storing state %v", err)
 		return clusterInfo, err
 	}
@@ -489,16 +877,19 @@ func (d *OCIOCNEDriver) Create(ctx context.Context, opts *types.DriverOptions, _
 func (d *OCIOCNEDriver) Update(ctx context.Context, info *types.ClusterInfo, opts *types.DriverOptions) (*types.ClusterInfo, error) {
 	d.Logger.Infof("capi.driver.Update(...) called")
 
-	state, err := d.loadVariables(info)
+	state, err := d.loadVariables(ctx, info)
 	if err != nil {
 		return info, err
 	}
-	newState, err := variables.NewFromOptions(ctx, opts)
-	if err != nil {
+	newState := variables.NewFromOptions(opts)
+	if err := state.SetUpdateValues(ctx, newState); err != nil {
 		return info, err
 	}
-
-	if err := state.SetUpdateValues(ctx, newState); err != nil {
+	// every problem with the options is reported before any OCI lookup
+	if err := state.Validate(); err != nil {
+		return info, err
+	}
+	if err := state.SetDynamicValues(ctx); err != nil {
 		return info, err
 	}
 	if err := storeVariables(info, state); err != nil {
@@ -512,9 +903,27 @@ func (d *OCIOCNEDriver) Update(ctx context.Context, info *types.ClusterInfo, opt
 	if err != nil {
 		return info, err
 	}
+	// a cluster that is still being created has no kubeconfig yet, and its credentials are rotated by PostCheck
+	if managedClusterKubeConfig, err := getManagedClusterKubeConfig(ctx, state); err == nil {
+		managedKi, err := k8s.NewInterfaceForKubeconfig(managedClusterKubeConfig)
+		if err != nil {
+			return info, fmt.Errorf("failed to create clientset for managed cluster %s: %v", state.Name, err)
+		}
+		managedDi, err := k8s.NewDynamicForKubeconfig(managedClusterKubeConfig)
+		if err != nil {
+			return info, fmt.Errorf("failed to create dynamic clientset for managed cluster %s: %v", state.Name, err)
+		}
+		if err := d.rotateCredentials(ctx, ki, managedKi, managedDi, state); err != nil {
+			return info, err
+		}
+		// record the applied fingerprint
+		if err := storeVariables(info, state); err != nil {
+			return info, err
+		}
+	}
 
 	if err := d.NewCAPIClient().UpdateCluster(ctx, ki, di, state); err != nil {
-		return info, err
+		return info, d.logProgress(state.Name, err)
 	}
 
 	return info, nil
@@ -523,7 +932,7 @@ func (d *OCIOCNEDriver) Update(ctx context.Context, info *types.ClusterInfo, opt
 func (d *OCIOCNEDriver) PostCheck(ctx context.Context, info *types.ClusterInfo) (*types.ClusterInfo, error) {
 	d.Logger.Infof("capi.driver.PostCheck(...) called")
 
-	state, err := d.loadVariables(info)
+	state, err := d.loadVariables(ctx, info)
 	if err != nil {
 		return info, err
 	}
@@ -532,7 +941,7 @@ func (d *OCIOCNEDriver) PostCheck(ctx context.Context, info *types.ClusterInfo)
 		return info, err
 	}
 	if err := capi.IsCAPIClusterReady(ctx, adminDi, state); err != nil {
-		return info, err
+		return info, d.logProgress(state.Name, err)
 	}
 	capiClusterKubeConfig, err := state.GetCAPIClusterKubeConfig(ctx)
 	if err != nil {
@@ -577,7 +986,7 @@ func (d *OCIOCNEDriver) PostCheck(ctx context.Context, info *types.ClusterInfo)
 	}
 
 	d.Logger.Infof("Creating service account token for cluster %v", state.Name)
-	info.ServiceAccountToken, err = d.generateServiceAccountToken(ctx, managedKI)
+	info.ServiceAccountToken, err = d.generateServiceAccountToken(ctx, managedKI, state)
 	if err != nil {
 		return info, fmt.Errorf("could not generate service account token: %v", err)
 	}
@@ -604,9 +1013,21 @@ func (d *OCIOCNEDriver) PostCheck(ctx context.Context, info *types.ClusterInfo)
 	if err := state.SetQuickCreateVCNInfo(ctx, adminDi); err != nil {
 		return info, err
 	}
-	if err := capiClient.InstallModules(ctx, managedKI, managedDI, state); err != nil {
+	adminKi, err := k8s.InjectedInterface()
+	if err != nil {
+		return info, err
+	}
+	if err := capiClient.InstallModules(ctx, adminKi, managedKI, managedDI, state); err != nil {
 		return info, fmt.Errorf("failed to install modules on managed cluster %s: %v", state.Name, err)
 	}
+	d.logClusterStatus(ctx, adminDi, managedDI, state)
+
+	if err := d.rotateCredentials(ctx, adminKi, managedKI, managedDI, state); err != nil {
+		return info, err
+	}
+	if err := storeVariables(info, state); err != nil {
+		return info, err
+	}
 
 	if err := capiClient.CreateClusterProvisionerConfigMap(ctx, managedDI, state); err != nil {
 		return info, fmt.Errorf("failed to create provisioner config map on managed cluster %s: %v", state.Name, err)
@@ -618,20 +1039,20 @@ func (d *OCIOCNEDriver) PostCheck(ctx context.Context, info *types.ClusterInfo)
 	}
 
 	d.Logger.Infof("Uninstalling Verrazzano on cluster %v", state.Name)
-	return info, capiClient.DeleteVerrazzanoResources(ctx, managedDI, adminDi, state)
+	return info, d.logProgress(state.Name, capiClient.DeleteVerrazzanoResources(ctx, managedDI, adminDi, state))
 
 }
 
-func (d *OCIOCNEDriver) GetClusterSize(_ context.Context, info *types.ClusterInfo) (*types.NodeCount, error) {
-	v, err := d.loadVariables(info)
+func (d *OCIOCNEDriver) GetClusterSize(ctx context.Context, info *types.ClusterInfo) (*types.NodeCount, error) {
+	v, err := d.loadState(info)
 	if err != nil {
 		return nil, err
 	}
 	return v.NodeCount()
 }
 
-func (d *OCIOCNEDriver) GetVersion(_ context.Context, info *types.ClusterInfo) (*types.KubernetesVersion, error) {
-	v, err := d.loadVariables(info)
+func (d *OCIOCNEDriver) GetVersion(ctx context.Context, info *types.ClusterInfo) (*types.KubernetesVersion, error) {
+	v, err := d.loadState(info)
 	if err != nil {
 		return nil, err
 	}
@@ -640,13 +1061,13 @@ func (d *OCIOCNEDriver) GetVersion(_ context.Context, info *types.ClusterInfo) (
 
 func (d *OCIOCNEDriver) SetClusterSize(ctx context.Context, info *types.ClusterInfo, count *types.NodeCount) error {
 	d.Logger.Infof("capi.driver.SetClusterSize(...) called")
-	state, err := d.loadVariables(info)
+	state, err := d.loadVariables(ctx, info)
 	if err != nil {
 		return err
 	}
 
-	if len(state.NodePools) > 0 {
-		state.NodePools[0].Replicas = count.Count
+	if err := state.SetClusterSize(count.Count); err != nil {
+		return err
 	}
 	if err := storeVariables(info, state); err != nil {
 		d.Logger.Errorf("Failed to save new node group size: %v", err)
@@ -658,7 +1079,10 @@ func (d *OCIOCNEDriver) SetClusterSize(ctx context.Context, info *types.ClusterI
 // SetVersion sets the Kubernetes Version of cluster
 func (d *OCIOCNEDriver) SetVersion(ctx context.Context, info *types.ClusterInfo, version *types.KubernetesVersion) error {
 	d.Logger.Infof("capi.driver.SetVersion(...) called")
-	state, err := d.loadVariables(info)
+	if version == nil || version.Version == "" {
+		return errors.New("no Kubernetes version requested")
+	}
+	state, err := d.loadVariables(ctx, info)
 	if err != nil {
 		return err
 	}
@@ -671,7 +1095,24 @@ func (d *OCIOCNEDriver) SetVersion(ctx context.Context, info *types.ClusterInfo,
 		return err
 	}
 
-	return d.NewCAPIClient().UpdateCluster(ctx, ki, di, state)
+	if err := state.SetKubernetesVersion(ctx, ki, version.Version); err != nil {
+		return fmt.Errorf("failed to set Kubernetes version %s: %v", version.Version, err)
+	}
+	if err := state.Validate(); err != nil {
+		return err
+	}
+	// a rejected version is never stored, so it does not change the cluster state
+	capiClient := d.NewCAPIClient()
+	if err := capiClient.CheckUpgrade(ctx, ki, di, state); err != nil {
+		return err
+	}
+	// the control plane and node pool templates are rolled when their hashes change
+	state.SetHashes()
+	if err := storeVariables(info, state); err != nil {
+		d.Logger.Errorf("Failed to save new Kubernetes version: %v", err)
+		return err
+	}
+	return capiClient.UpdateCluster(ctx, ki, di, state)
 }
 
 func (d *OCIOCNEDriver) GetCapabilities(_ context.Context) (*types.Capabilities, error) {
@@ -681,17 +1122,29 @@ func (d *OCIOCNEDriver) GetCapabilities(_ context.Context) (*types.Capabilities,
 
 func (d *OCIOCNEDriver) ETCDSave(ctx context.Context, clusterInfo *types.ClusterInfo, opts *types.DriverOptions, snapshotName string) error {
 	d.Logger.Infof("capi.driver.ETCDSave(...) called")
-	return fmt.Errorf("ETCD backup operations are not implemented")
+	snapshotClient, err := d.newSnapshotClient(ctx, clusterInfo)
+	if err != nil {
+		return err
+	}
+	return snapshotClient.Save(ctx, snapshotName)
 }
 
 func (d *OCIOCNEDriver) ETCDRestore(ctx context.Context, clusterInfo *types.ClusterInfo, opts *types.DriverOptions, snapshotName string) (*types.ClusterInfo, error) {
 	d.Logger.Infof("capi.driver.ETCDRestore(...) called")
-	return nil, fmt.Errorf("ETCD backup operations are not implemented")
+	snapshotClient, err := d.newSnapshotClient(ctx, clusterInfo)
+	if err != nil {
+		return clusterInfo, err
+	}
+	return clusterInfo, snapshotClient.Restore(ctx, snapshotName)
 }
 
 func (d *OCIOCNEDriver) ETCDRemoveSnapshot(ctx context.Context, clusterInfo *types.ClusterInfo, opts *types.DriverOptions, snapshotName string) error {
 	d.Logger.Infof("capi.driver.ETCDRemoveSnapshot(...) called")
-	return fmt.Errorf("ETCD backup operations are not implemented")
+	snapshotClient, err := d.newSnapshotClient(ctx, clusterInfo)
+	if err != nil {
+		return err
+	}
+	return snapshotClient.Remove(ctx, snapshotName)
 }
 
 func (d *OCIOCNEDriver) GetK8SCapabilities(ctx context.Context, options *types.DriverOptions) (*types.K8SCapabilities, error) {
@@ -713,7 +1166,7 @@ func (d *OCIOCNEDriver) RemoveLegacyServiceAccount(ctx context.Context, info *ty
 }
 
 func storeVariables(info *types.ClusterInfo, v *variables.Variables) error {
-	bytes, err := json.Marshal(v)
+	state, err := v.State()
 	if err != nil {
 		return fmt.Errorf("could not marshal state: %v", err)
 	}
@@ -722,110 +1175,120 @@ func storeVariables(info *types.ClusterInfo, v *variables.Variables) error {
 		info.Metadata = map[string]string{}
 	}
 
-	info.Metadata[metadataKey] = string(bytes)
+	info.Metadata[metadataKey] = state
 	return nil
 }
 
-func (d *OCIOCNEDriver) loadVariables(info *types.ClusterInfo) (*variables.Variables, error) {
-	d.Logger.Infof("capi.driver.loadVariables(...) called")
-	state := &variables.Variables{}
-	err := json.Unmarshal([]byte(info.Metadata[metadataKey]), &state)
-	return state, err
+// loadState loads the driver state without the OCI credentials, for operations that neither call OCI nor render credentials
+func (d *OCIOCNEDriver) loadState(info *types.ClusterInfo) (*variables.Variables, error) {
+	state, migrated, err := variables.LoadState(info.Metadata[metadataKey])
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal state: %v", err)
+	}
+	// rewrite state from older driver versions
+	if migrated {
+		if err := storeVariables(info, state); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
 }
 
-// GenerateServiceAccountToken generate a serviceAccountToken for clusterAdmin given a clientset
-func (d *OCIOCNEDriver) generateServiceAccountToken(ctx context.Context, clientset kubernetes.Interface) (string, error) {
-
-	token := ""
-	namespace := "default"
-	name := "kontainer-engine-olcne"
-
-	serverVersion, err := clientset.Discovery().ServerVersion()
+// loadVariables loads the driver state, and the OCI credentials from the cloud credential
+func (d *OCIOCNEDriver) loadVariables(ctx context.Context, info *types.ClusterInfo) (*variables.Variables, error) {
+	d.Logger.Infof("capi.driver.loadVariables(...) called")
+	state, err := d.loadState(info)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	d.Logger.Debugf("[oraclecontainerengine] Kubernetes server version: %s", serverVersion)
 
-	serviceAccount := &v1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name}}
-
-	// Create new service account, if it does not exist already
-	_, err = clientset.CoreV1().ServiceAccounts(namespace).Create(ctx, serviceAccount, metav1.CreateOptions{})
+	ki, err := k8s.InjectedInterface()
 	if err != nil {
-		if !apierrors.IsAlreadyExists(err) {
-			return "", err
-		}
+		return nil, err
+	}
+	if err := variables.SetupOCIAuth(ctx, ki, state); err != nil {
+		return nil, fmt.Errorf("failed to load OCI credentials from cloud credential %s: %v", state.CloudCredentialId, err)
 	}
+	return state, nil
+}
 
-	serviceAccount, err = clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, name, metav1.GetOptions{})
+// rotateCredentials pushes a rotated cloud credential to the CAPI secret and the managed cluster
+func (d *OCIOCNEDriver) rotateCredentials(ctx context.Context, adminKi, managedKi kubernetes.Interface, managedDi dynamic.Interface, state *variables.Variables) error {
+	rotation, err := d.NewCAPIClient().RotateCredentials(ctx, adminKi, managedKi, managedDi, state)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("failed to rotate OCI credentials for cluster %s: %v", state.Name, err)
 	}
-
-	// Template for an authentication token secret bound to the service account
-	secretTemplate := &v1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: serviceAccount.Name + "-token",
-			OwnerReferences: []metav1.OwnerReference{
-				{
-					APIVersion: "v1",
-					Kind:       "ServiceAccount",
-					Name:       serviceAccount.Name,
-					UID:        serviceAccount.UID,
-				},
-			},
-			Annotations: map[string]string{
-				v1.ServiceAccountNameKey: serviceAccount.Name,
-			},
-		},
-		Type: v1.SecretTypeServiceAccountToken,
+	if rotation != nil {
+		d.Logger.Infof("Rotated OCI credentials for cluster %s, %s", state.Name, rotation)
 	}
+	return nil
+}
 
-	_, err = clientset.CoreV1().Secrets(namespace).Create(ctx, secretTemplate, metav1.CreateOptions{})
+// GenerateServiceAccountToken generate a serviceAccountToken for Rancher given a clientset
+func (d *OCIOCNEDriver) generateServiceAccountToken(ctx context.Context, clientset kubernetes.Interface, state *variables.Variables) (string, error) {
+	serverVersion, err := clientset.Discovery().ServerVersion()
 	if err != nil {
-		if !apierrors.IsAlreadyExists(err) {
-			return "", err
-		}
+		return "", err
 	}
-	// wait a few seconds for authentication token to populate
-	time.Sleep(10 * time.Second)
+	d.Logger.Debugf("[oraclecontainerengine] Kubernetes server version: %s", serverVersion)
 
-	secretObj, err := clientset.CoreV1().Secrets(namespace).Get(ctx, serviceAccount.Name+"-token", metav1.GetOptions{})
+	sa := newServiceAccount(state.ServiceAccountNamespace, state.ServiceAccountClusterRole)
+	sa.TokenExpiration = time.Duration(state.ServiceAccountTokenExpirationHours) * time.Hour
+	sa.TokenRotation = time.Duration(state.ServiceAccountTokenRotationHours) * time.Hour
+	token, err := sa.Token(ctx, clientset)
 	if err != nil {
 		return "", err
 	}
-
-	// Create new cluster-role-bindings, if it does not exist already
-	clusterRoleBinding := &rbacv1.ClusterRoleBinding{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: name,
-		},
-		Subjects: []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, APIGroup: "", Name: name, Namespace: namespace}},
-		RoleRef: rbacv1.RoleRef{
-			Kind: "ClusterRole",
-			Name: "cluster-admin",
-		},
+	previous := newServiceAccount(state.AppliedServiceAccountNamespace, state.AppliedServiceAccountClusterRole)
+	if err := sa.DeleteStale(ctx, clientset, previous); err != nil {
+		return "", fmt.Errorf("failed to clean up previous service account: %v", err)
 	}
+	state.AppliedServiceAccountNamespace = sa.Namespace
+	state.AppliedServiceAccountClusterRole = sa.ClusterRole
+	return token, nil
+}
 
-	_, err = clientset.RbacV1().ClusterRoleBindings().Create(ctx, clusterRoleBinding, metav1.CreateOptions{})
-	if err != nil {
-		if !apierrors.IsAlreadyExists(err) {
-			return "", err
-		}
+// deleteServiceAccount removes the service account Rancher uses to manage the cluster
+func (d *OCIOCNEDriver) deleteServiceAccount(ctx context.Context, clientset kubernetes.Interface, state *variables.Variables) error {
+	applied := newServiceAccount(state.AppliedServiceAccountNamespace, state.AppliedServiceAccountClusterRole)
+	if err := applied.Delete(ctx, clientset); err != nil {
+		return err
 	}
+	// the settings may have changed without being applied yet
+	return newServiceAccount(state.ServiceAccountNamespace, state.ServiceAccountClusterRole).Delete(ctx, clientset)
+}
 
-	// Look up cluster role binding
-	_, err = clientset.RbacV1().ClusterRoleBindings().Get(ctx, clusterRoleBinding.Name, metav1.GetOptions{})
-	if err != nil {
-		return "", fmt.Errorf("error getting cluster role binding: %v", err)
+// newServiceAccount creates the service account for the namespace and cluster role options, state from older driver versions has neither
+func newServiceAccount(namespace, clusterRole string) *k8s.ServiceAccount {
+	sa := k8s.NewServiceAccount()
+	if namespace != "" {
+		sa.Namespace = namespace
+	}
+	if clusterRole != "" {
+		sa.ClusterRole = clusterRole
 	}
+	return sa
+}
 
-	// get the bearer token from the token-secret
-	if byteToken, ok := secretObj.Data[v1.ServiceAccountTokenKey]; ok {
-		token = string(byteToken)
-		return token, nil
+// logProgress logs errors that only report the cluster is still progressing, so they can be told apart from failures
+func (d *OCIOCNEDriver) logProgress(name string, err error) error {
+	if capi.IsProgressing(err) {
+		d.Logger.Infof("Cluster %s is still progressing: %v", name, err)
 	}
+	return err
+}
 
-	return "", fmt.Errorf("error getting authentication token from secret: %s", secretObj.Name)
+// logClusterStatus logs the readiness of every component of the cluster
+func (d *OCIOCNEDriver) logClusterStatus(ctx context.Context, adminDi, managedDi dynamic.Interface, state *variables.Variables) {
+	status, err := capi.GetClusterStatus(ctx, adminDi, state)
+	if err == nil {
+		err = status.LoadManagedClusterStatus(ctx, managedDi, state)
+	}
+	if err != nil {
+		d.Logger.Warnf("failed to get status of cluster %s: %v", state.Name, err)
+		return
+	}
+	d.Logger.Infof("Cluster %s status: %s", state.Name, status.Summary())
 }
 
 func (d *OCIOCNEDriver) doCreateOrUpdate(ctx context.Context, state *variables.Variables) error {
@@ -864,6 +1327,26 @@ func getManagedClusterKubeConfig(ctx context.Context, state *variables.Variables
 	return yaml.Marshal(&capiClusterKubeConfig)
 }
 
+func (d *OCIOCNEDriver) newSnapshotClient(ctx context.Context, info *types.ClusterInfo) (*etcd.SnapshotClient, error) {
+	state, err := d.loadState(info)
+	if err != nil {
+		return nil, err
+	}
+	adminKi, err := k8s.InjectedInterface()
+	if err != nil {
+		return nil, fmt.Errorf("failed to created admin cluster client: %v", err)
+	}
+	managedClusterKubeConfig, err := getManagedClusterKubeConfig(ctx, state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get managed cluster kubeconfig: %v", err)
+	}
+	managedKi, err := k8s.NewInterfaceForKubeconfig(managedClusterKubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset for managed cluster %s: %v", state.Name, err)
+	}
+	return etcd.NewSnapshotClient(ctx, d.Logger, adminKi, managedKi, state)
+}
+
 func (d *OCIOCNEDriver) NewCAPIClient() *capi.CAPIClient {
 	return capi.NewCAPIClient(d.Logger)
 }
@@ -29,6 +29,9 @@ var MachineDeployment string
 //go:embed ocimachinetemplate.goyaml
 var OCIMachineTemplate string
 
+//go:embed machinehealthcheck.goyaml
+var MachineHealthCheck string
+
 //go:embed ccmsecret.goyaml
 var CCMSecret string
 
@@ -41,6 +44,9 @@ var CCMModule string
 //go:embed calico-module.goyaml
 var CalicoModule string
 
+//go:embed cluster-autoscaler-module.goyaml
+var ClusterAutoscalerModule string
+
 //go:embed vmc.goyaml
 var VMC string
 
@@ -37,20 +37,33 @@ func (v *Variables) SetControlPlaneHash() {
 	v.ControlPlaneHash = hashSum(b.String())
 }
 
+// SetNodePoolHash computes a hash for each node pool, so changing one node pool only rolls that node pool
 func (v *Variables) SetNodePoolHash() {
+	for i := range v.NodePools {
+		v.NodePools[i].Hash = v.nodePoolHash(v.NodePools[i])
+	}
+}
+
+func (v *Variables) nodePoolHash(np NodePool) string {
 	b := strings.Builder{}
 	b.WriteString(v.KubernetesVersion)
 	b.WriteString(v.SSHPublicKey)
 	b.WriteString(v.ActualImage)
 	// changing node pool replicas does not require a new template hash, since it is a scale up/scale down
-	for _, np := range v.NodePools {
-		b.WriteString(np.Name)
-		b.WriteString(np.Shape)
-		b.WriteString(fmt.Sprintf("%d", np.Memory))
-		b.WriteString(fmt.Sprintf("%d", np.Ocpus))
-	}
+	b.WriteString(np.Name)
+	b.WriteString(np.Shape)
+	b.WriteString(fmt.Sprintf("%d", np.Memory))
+	b.WriteString(fmt.Sprintf("%d", np.Ocpus))
+	b.WriteString(fmt.Sprintf("%d", np.VolumeSize))
+	b.WriteString(np.ActualImage)
+	b.WriteString(np.SSHPublicKey)
+	b.WriteString(np.SubnetId)
+	b.WriteString(np.FaultDomain)
+	b.WriteString(fmt.Sprintf("%d", np.BootVolumeVpusPerGB))
+	b.WriteString(fmt.Sprintf("%v", np.KubeletArgs()))
+	b.WriteString(fmt.Sprintf("%v", np.Taints))
 	b.WriteString(fmt.Sprintf("%v", v.NodePVTransitEncryption))
-	v.NodePoolHash = hashSum(b.String())
+	return hashSum(b.String())
 }
 
 func hashSum(input string) string {
@@ -0,0 +1,139 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package variables
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMachineHealthCheckMaxUnhealthy       = "40%"
+	DefaultMachineHealthCheckNodeStartupTimeout = "20m"
+	DefaultMachineHealthCheckUnhealthyTimeout   = "5m"
+
+	controlPlaneLabel = "cluster.x-k8s.io/control-plane"
+	deploymentLabel   = "cluster.x-k8s.io/deployment-name"
+)
+
+// MachineHealthCheck configures Cluster API remediation of unhealthy nodes. Unset fields use the cluster defaults.
+type MachineHealthCheck struct {
+	MaxUnhealthy        string               `json:"maxUnhealthy,omitempty"`
+	NodeStartupTimeout  string               `json:"nodeStartupTimeout,omitempty"`
+	UnhealthyConditions []UnhealthyCondition `json:"unhealthyConditions,omitempty"`
+}
+
+// UnhealthyCondition is a node condition that marks a node unhealthy once it has lasted for the timeout
+type UnhealthyCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Timeout string `json:"timeout"`
+}
+
+// MachineHealthCheckObject is a MachineHealthCheck with the cluster defaults applied, for templating
+type MachineHealthCheckObject struct {
+	MachineHealthCheck
+	Name string
+	// Label is the value of the machine health check label, the node pool name or control-plane
+	Label string
+	// Selector are the labels of the Machines the MachineHealthCheck applies to
+	Selector map[string]string
+}
+
+// MaxUnhealthyValue is maxUnhealthy as YAML, since it is either a number or a percentage
+func (mhc MachineHealthCheckObject) MaxUnhealthyValue() string {
+	if strings.HasSuffix(mhc.MaxUnhealthy, "%") {
+		return strconv.Quote(mhc.MaxUnhealthy)
+	}
+	return mhc.MaxUnhealthy
+}
+
+// MachineHealthChecks are the MachineHealthChecks of the control plane and node pools that enable them
+func (v Variables) MachineHealthChecks() []MachineHealthCheckObject {
+	var mhcs []MachineHealthCheckObject
+	if v.ControlPlaneMachineHealthCheck {
+		mhcs = append(mhcs, MachineHealthCheckObject{
+			MachineHealthCheck: v.withMachineHealthCheckDefaults(nil),
+			Name:               fmt.Sprintf("%s-control-plane", v.Name),
+			Label:              "control-plane",
+			Selector: map[string]string{
+				controlPlaneLabel: "",
+			},
+		})
+	}
+	for _, np := range v.NodePools {
+		if np.MachineHealthCheck == nil {
+			continue
+		}
+		mhcs = append(mhcs, MachineHealthCheckObject{
+			MachineHealthCheck: v.withMachineHealthCheckDefaults(np.MachineHealthCheck),
+			Name:               np.Name,
+			Label:              np.Name,
+			Selector: map[string]string{
+				deploymentLabel: np.Name,
+			},
+		})
+	}
+	return mhcs
+}
+
+func (v Variables) withMachineHealthCheckDefaults(mhc *MachineHealthCheck) MachineHealthCheck {
+	result := MachineHealthCheck{}
+	if mhc != nil {
+		result = *mhc
+	}
+	if result.MaxUnhealthy == "" {
+		result.MaxUnhealthy = valueOrDefault(v.MachineHealthCheckMaxUnhealthy, DefaultMachineHealthCheckMaxUnhealthy)
+	}
+	if result.NodeStartupTimeout == "" {
+		result.NodeStartupTimeout = valueOrDefault(v.MachineHealthCheckNodeStartupTimeout, DefaultMachineHealthCheckNodeStartupTimeout)
+	}
+	if len(result.UnhealthyConditions) < 1 {
+		timeout := valueOrDefault(v.MachineHealthCheckUnhealthyTimeout, DefaultMachineHealthCheckUnhealthyTimeout)
+		result.UnhealthyConditions = []UnhealthyCondition{
+			{Type: "Ready", Status: "False", Timeout: timeout},
+			{Type: "Ready", Status: "Unknown", Timeout: timeout},
+		}
+	}
+	return result
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// validate reports every problem with the MachineHealthCheck settings, as messages prefixed with the owner name
+func (mhc MachineHealthCheck) validate(owner string) []string {
+	var problems []string
+	if mhc.MaxUnhealthy != "" {
+		value := strings.TrimSuffix(mhc.MaxUnhealthy, "%")
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			problems = append(problems, fmt.Sprintf("%s maxUnhealthy '%s' must be a number or a percentage", owner, mhc.MaxUnhealthy))
+		}
+	}
+	if mhc.NodeStartupTimeout != "" {
+		if _, err := time.ParseDuration(mhc.NodeStartupTimeout); err != nil {
+			problems = append(problems, fmt.Sprintf("%s nodeStartupTimeout '%s' is not a valid duration", owner, mhc.NodeStartupTimeout))
+		}
+	}
+	for _, condition := range mhc.UnhealthyConditions {
+		if condition.Type == "" {
+			problems = append(problems, fmt.Sprintf("%s unhealthy condition type is required", owner))
+		}
+		switch condition.Status {
+		case "True", "False", "Unknown":
+		default:
+			problems = append(problems, fmt.Sprintf("%s unhealthy condition %s has unknown status '%s'", owner, condition.Type, condition.Status))
+		}
+		if _, err := time.ParseDuration(condition.Timeout); err != nil {
+			problems = append(problems, fmt.Sprintf("%s unhealthy condition %s timeout '%s' is not a valid duration", owner, condition.Type, condition.Timeout))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,385 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package variables
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	DefaultControlPlaneSubnetPrefixLength         = 29
+	DefaultControlPlaneEndpointSubnetPrefixLength = 29
+	DefaultLoadBalancerSubnetPrefixLength         = 27
+	DefaultWorkerSubnetPrefixLength               = 20
+
+	// OCI VCNs are between /16 and /30, and subnets are at most /30
+	minVCNPrefixLength    = 16
+	maxVCNPrefixLength    = 30
+	maxSubnetPrefixLength = 30
+
+	anywhereCIDR = "0.0.0.0/0"
+	// SSHDisabled as the only SSH allowed CIDR disables SSH ingress
+	SSHDisabled = "none"
+
+	protocolAll    = "all"
+	protocolICMP   = "1"
+	protocolIPinIP = "4"
+	protocolTCP    = "6"
+
+	subnetPublic  = "public"
+	subnetPrivate = "private"
+)
+
+// SubnetPrefixLengths are the sizes of the Quick Create subnets. Unset sizes use the defaults.
+type SubnetPrefixLengths struct {
+	ControlPlane         int
+	ControlPlaneEndpoint int
+	LoadBalancer         int
+	Worker               int
+}
+
+// NetworkAccess is the access to the cluster from outside the VCN
+type NetworkAccess struct {
+	// Private clusters have only private subnets, and no internet gateway
+	Private bool
+	// AllowedCIDRs may reach the Kubernetes API endpoint and SSH of private clusters, defaulting to the VCN CIDR.
+	// The Kubernetes API endpoint always accepts traffic from the VCN, since the nodes join the cluster through it.
+	AllowedCIDRs []string
+	// APIServerCIDRs and SSHCIDRs override the CIDRs that may reach the Kubernetes API endpoint and SSH
+	APIServerCIDRs []string
+	SSHCIDRs       []string
+}
+
+// sources are the CIDRs allowed by the configured allow-list, or the defaults of the cluster mode
+func (a NetworkAccess) sources(configured []string, vcn string) []string {
+	switch {
+	case len(configured) > 0:
+		return configured
+	case !a.Private:
+		return []string{anywhereCIDR}
+	case len(a.AllowedCIDRs) > 0:
+		return a.AllowedCIDRs
+	default:
+		return []string{vcn}
+	}
+}
+
+// SSHDisabled is true if SSH ingress is disabled
+func (a NetworkAccess) SSHDisabled() bool {
+	return len(a.SSHCIDRs) == 1 && a.SSHCIDRs[0] == SSHDisabled
+}
+
+// NetworkPlan is the layout of a Quick Create VCN
+type NetworkPlan struct {
+	CIDR                  string
+	Private               bool
+	Subnets               []Subnet
+	NetworkSecurityGroups []NetworkSecurityGroup
+}
+
+// NetworkSecurityGroup is the network security group of the nodes or load balancers of a subnet role
+type NetworkSecurityGroup struct {
+	// Id is set for the existing network security groups of an existing VCN
+	Id           string
+	Name         string
+	Role         string
+	EgressRules  []SecurityRule
+	IngressRules []SecurityRule
+}
+
+// SecurityRule is a stateful ingress or egress rule of a network security group
+type SecurityRule struct {
+	Description string
+	// Protocol is the IANA protocol number, or all
+	Protocol string
+	// CIDR is the source of ingress rules, and the destination of egress rules
+	CIDR string
+	// MinPort and MaxPort are the TCP destination port range, unset for other protocols
+	MinPort int
+	MaxPort int
+	// PathDiscovery matches ICMP destination unreachable, fragmentation needed messages
+	PathDiscovery bool
+}
+
+// QuickCreateNetwork is the network plan of the Quick Create VCN, for templating
+func (v Variables) QuickCreateNetwork() (*NetworkPlan, error) {
+	return PlanNetwork(v.QuickCreateVCNCIDR(), v.SubnetPrefixLengths(), v.NetworkAccess())
+}
+
+// NetworkAccess is the configured access to the cluster from outside the VCN
+func (v Variables) NetworkAccess() NetworkAccess {
+	return NetworkAccess{
+		Private:        v.PrivateCluster,
+		AllowedCIDRs:   v.AllowedCIDRs,
+		APIServerCIDRs: v.APIServerAllowedCIDRs,
+		SSHCIDRs:       v.SSHAllowedCIDRs,
+	}
+}
+
+// QuickCreateVCNCIDR is the CIDR of the Quick Create VCN. Clusters created before the VCN CIDR option used the cluster CIDR.
+func (v Variables) QuickCreateVCNCIDR() string {
+	return valueOrDefault(v.VCNCIDR, v.ClusterCIDR)
+}
+
+// NoProxy are the cluster, pod and VCN CIDRs, so traffic between nodes and the API endpoint bypasses the proxy
+func (v Variables) NoProxy() string {
+	cidrs := []string{v.ClusterCIDR, v.PodCIDR}
+	if v.QuickCreateVCN {
+		cidrs = append(cidrs, v.QuickCreateVCNCIDR())
+	} else {
+		cidrs = append(cidrs, v.ExistingVCNCIDRs...)
+	}
+	var noProxy []string
+	seen := map[string]bool{}
+	for _, cidr := range cidrs {
+		if cidr == "" || seen[cidr] {
+			continue
+		}
+		seen[cidr] = true
+		noProxy = append(noProxy, cidr)
+	}
+	return strings.Join(noProxy, ",")
+}
+
+// SubnetPrefixLengths are the configured Quick Create subnet sizes
+func (v Variables) SubnetPrefixLengths() SubnetPrefixLengths {
+	return SubnetPrefixLengths{
+		ControlPlane:         int(v.ControlPlaneSubnetPrefixLength),
+		ControlPlaneEndpoint: int(v.ControlPlaneEndpointSubnetPrefixLength),
+		LoadBalancer:         int(v.LoadBalancerSubnetPrefixLength),
+		Worker:               int(v.WorkerSubnetPrefixLength),
+	}
+}
+
+// withDefaults sets unset sizes to the defaults. The default worker subnet is a quarter of a small VCN.
+func (p SubnetPrefixLengths) withDefaults(vcnPrefixLength int) SubnetPrefixLengths {
+	if p.ControlPlane == 0 {
+		p.ControlPlane = DefaultControlPlaneSubnetPrefixLength
+	}
+	if p.ControlPlaneEndpoint == 0 {
+		p.ControlPlaneEndpoint = DefaultControlPlaneEndpointSubnetPrefixLength
+	}
+	if p.LoadBalancer == 0 {
+		p.LoadBalancer = DefaultLoadBalancerSubnetPrefixLength
+	}
+	if p.Worker == 0 {
+		p.Worker = DefaultWorkerSubnetPrefixLength
+		if vcnPrefixLength+2 > p.Worker {
+			p.Worker = vcnPrefixLength + 2
+		}
+	}
+	return p
+}
+
+// PlanNetwork carves the Quick Create subnets out of the VCN CIDR, and generates the network security group rules between them.
+// The control plane, control plane endpoint and service load balancer subnets are allocated from the start of the VCN,
+// and the worker subnet from the second quarter of the VCN, matching the Cluster API OCI provider's default layout.
+func PlanNetwork(vcnCIDR string, prefixLengths SubnetPrefixLengths, access NetworkAccess) (*NetworkPlan, error) {
+	_, vcn, err := net.ParseCIDR(vcnCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VCN CIDR %s: %v", vcnCIDR, err)
+	}
+	vcnIP := vcn.IP.To4()
+	if vcnIP == nil {
+		return nil, fmt.Errorf("VCN CIDR %s is not an IPv4 CIDR", vcnCIDR)
+	}
+	vcnPrefixLength, _ := vcn.Mask.Size()
+	if vcnPrefixLength < minVCNPrefixLength || vcnPrefixLength > maxVCNPrefixLength {
+		return nil, fmt.Errorf("VCN CIDR %s must be between /%d and /%d", vcnCIDR, minVCNPrefixLength, maxVCNPrefixLength)
+	}
+	prefixLengths = prefixLengths.withDefaults(vcnPrefixLength)
+
+	base := binary.BigEndian.Uint32(vcnIP)
+	vcnSize := uint64(1) << (32 - vcnPrefixLength)
+	var next uint64
+	allocate := func(role string, prefixLength int, start uint64) (string, error) {
+		if prefixLength < vcnPrefixLength || prefixLength > maxSubnetPrefixLength {
+			return "", fmt.Errorf("%s subnet prefix length %d must be between %d and %d", role, prefixLength, vcnPrefixLength, maxSubnetPrefixLength)
+		}
+		size := uint64(1) << (32 - prefixLength)
+		if start < next {
+			start = next
+		}
+		// subnets are aligned to their size
+		offset := (start + size - 1) / size * size
+		if offset+size > vcnSize {
+			return "", fmt.Errorf("%s subnet /%d does not fit in VCN %s after the other subnets, use a larger VCN or smaller subnets", role, prefixLength, vcn.String())
+		}
+		next = offset + size
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, base+uint32(offset))
+		return fmt.Sprintf("%s/%d", ip.String(), prefixLength), nil
+	}
+
+	controlPlane, err := allocate(controlPlaneSubnetRole, prefixLengths.ControlPlane, 0)
+	if err != nil {
+		return nil, err
+	}
+	endpoint, err := allocate(controlPlaneEndpointSubnetRole, prefixLengths.ControlPlaneEndpoint, 0)
+	if err != nil {
+		return nil, err
+	}
+	loadBalancer, err := allocate(loadBalancerSubnetRole, prefixLengths.LoadBalancer, 0)
+	if err != nil {
+		return nil, err
+	}
+	worker, err := allocate(workerSubnetRole, prefixLengths.Worker, vcnSize/4)
+	if err != nil {
+		return nil, err
+	}
+
+	// public clusters have public endpoint and load balancer subnets
+	edgeSubnetType := subnetPublic
+	if access.Private {
+		edgeSubnetType = subnetPrivate
+	}
+	apiSources := access.sources(access.APIServerCIDRs, vcn.String())
+	var sshSources []string
+	if !access.SSHDisabled() {
+		sshSources = access.sources(access.SSHCIDRs, vcn.String())
+	}
+	return &NetworkPlan{
+		CIDR:    vcn.String(),
+		Private: access.Private,
+		Subnets: []Subnet{
+			quickCreateSubnet(controlPlaneEndpointSubnetRole, endpoint, edgeSubnetType),
+			quickCreateSubnet(controlPlaneSubnetRole, controlPlane, subnetPrivate),
+			quickCreateSubnet(loadBalancerSubnetRole, loadBalancer, edgeSubnetType),
+			quickCreateSubnet(workerSubnetRole, worker, subnetPrivate),
+		},
+		NetworkSecurityGroups: networkSecurityGroups(vcn.String(), controlPlane, endpoint, worker, apiSources, sshSources),
+	}, nil
+}
+
+func quickCreateSubnet(role, cidr, subnetType string) Subnet {
+	return Subnet{
+		Role: role,
+		Name: quickCreateName(role),
+		CIDR: cidr,
+		Type: subnetType,
+	}
+}
+
+func quickCreateName(role string) string {
+	return fmt.Sprintf("ocne-%s", role)
+}
+
+// networkSecurityGroups are the network security groups of the Quick Create subnet roles.
+// The Kubernetes API endpoint accepts traffic from the VCN and its sources, and SSH accepts traffic from its sources.
+func networkSecurityGroups(vcn, controlPlane, endpoint, worker string, apiSources, sshSources []string) []NetworkSecurityGroup {
+	apiRules := []SecurityRule{
+		tcpRule("Kubernetes API traffic from the VCN", vcn, 6443, 6443),
+	}
+	var controlPlaneSSHRules, workerSSHRules []SecurityRule
+	for _, source := range apiSources {
+		if source == vcn {
+			continue
+		}
+		apiRules = append(apiRules, tcpRule("External access to Kubernetes API endpoint", source, 6443, 6443))
+	}
+	for _, source := range sshSources {
+		controlPlaneSSHRules = append(controlPlaneSSHRules, tcpRule("Inbound SSH traffic to Control Plane", source, 22, 22))
+		workerSSHRules = append(workerSSHRules, tcpRule("Inbound SSH traffic to worker node", source, 22, 22))
+	}
+	return []NetworkSecurityGroup{
+		{
+			Name: quickCreateName(controlPlaneEndpointSubnetRole),
+			Role: controlPlaneEndpointSubnetRole,
+			EgressRules: []SecurityRule{
+				tcpRule("Kubernetes API traffic to Control Plane", controlPlane, 6443, 6443),
+			},
+			IngressRules: append(apiRules,
+				pathDiscoveryRule("ICMP Path discovery", vcn),
+			),
+		},
+		{
+			Name: quickCreateName(controlPlaneSubnetRole),
+			Role: controlPlaneSubnetRole,
+			EgressRules: []SecurityRule{
+				{Description: "Control Plane access to Internet", Protocol: protocolAll, CIDR: anywhereCIDR},
+			},
+			IngressRules: concatRules([]SecurityRule{
+				{Description: "Inbound East-West traffic", Protocol: protocolAll, CIDR: vcn},
+				tcpRule("Kubernetes API endpoint to Control Plane(apiserver port) communication", endpoint, 6443, 6443),
+				tcpRule("Control plane node to Control Plane(apiserver port) communication", controlPlane, 6443, 6443),
+				tcpRule("Worker Node to Control Plane(apiserver port) communication", worker, 6443, 6443),
+				tcpRule("etcd client communication", controlPlane, 2379, 2379),
+				tcpRule("etcd peer", controlPlane, 2380, 2380),
+				tcpRule("Calico networking (BGP)", controlPlane, 179, 179),
+				tcpRule("Calico networking (BGP)", worker, 179, 179),
+				{Description: "Calico networking with IP-in-IP enabled", Protocol: protocolIPinIP, CIDR: controlPlane},
+				{Description: "Calico networking with IP-in-IP enabled", Protocol: protocolIPinIP, CIDR: worker},
+				pathDiscoveryRule("Path discovery", vcn),
+			}, controlPlaneSSHRules, []SecurityRule{
+				tcpRule("Control Plane to Control Plane Kubelet Communication", controlPlane, 10250, 10250),
+			}),
+		},
+		{
+			Name: quickCreateName(workerSubnetRole),
+			Role: workerSubnetRole,
+			EgressRules: []SecurityRule{
+				{Description: "Worker node access to Internet", Protocol: protocolAll, CIDR: anywhereCIDR},
+			},
+			IngressRules: concatRules([]SecurityRule{
+				{Description: "Inbound East-West traffic", Protocol: protocolAll, CIDR: vcn},
+			}, workerSSHRules, []SecurityRule{
+				pathDiscoveryRule("Path discovery", vcn),
+				tcpRule("Control Plane to worker node Kubelet Communication", controlPlane, 10250, 10250),
+				tcpRule("Worker node to worker node Kubelet Communication", worker, 10250, 10250),
+				tcpRule("Calico networking (BGP)", controlPlane, 179, 179),
+				tcpRule("Calico networking (BGP)", worker, 179, 179),
+				{Description: "Calico networking with IP-in-IP enabled", Protocol: protocolIPinIP, CIDR: controlPlane},
+				{Description: "Calico networking with IP-in-IP enabled", Protocol: protocolIPinIP, CIDR: worker},
+				tcpRule("Worker node to default NodePort ingress communication", worker, 30000, 32767),
+			}),
+		},
+		{
+			Name: quickCreateName(loadBalancerSubnetRole),
+			Role: loadBalancerSubnetRole,
+			EgressRules: []SecurityRule{
+				tcpRule("Service LoadBalancer to default NodePort egress communication", worker, 30000, 32767),
+			},
+			IngressRules: []SecurityRule{
+				pathDiscoveryRule("Path discovery", vcn),
+				tcpRule("Accept http traffic on port 80", anywhereCIDR, 80, 80),
+				tcpRule("Accept https traffic on port 443", anywhereCIDR, 443, 443),
+			},
+		},
+	}
+}
+
+func concatRules(rules ...[]SecurityRule) []SecurityRule {
+	var result []SecurityRule
+	for _, r := range rules {
+		result = append(result, r...)
+	}
+	return result
+}
+
+func tcpRule(description, cidr string, minPort, maxPort int) SecurityRule {
+	return SecurityRule{
+		Description: description,
+		Protocol:    protocolTCP,
+		CIDR:        cidr,
+		MinPort:     minPort,
+		MaxPort:     maxPort,
+	}
+}
+
+func pathDiscoveryRule(description, cidr string) SecurityRule {
+	return SecurityRule{
+		Description:   description,
+		Protocol:      protocolICMP,
+		CIDR:          cidr,
+		PathDiscovery: true,
+	}
+}
+
+// cidrsOverlap is true if either CIDR contains the other
+func cidrsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
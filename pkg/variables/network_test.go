@@ -0,0 +1,237 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package variables
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestPlanNetwork(t *testing.T) {
+	var tests = []struct {
+		name          string
+		vcnCIDR       string
+		prefixLengths SubnetPrefixLengths
+		// subnet CIDRs in the order endpoint, control plane, service load balancer, worker
+		subnets []string
+		err     string
+	}{
+		{
+			"default layout",
+			"10.96.0.0/16",
+			SubnetPrefixLengths{},
+			[]string{"10.96.0.8/29", "10.96.0.0/29", "10.96.0.32/27", "10.96.64.0/20"},
+			"",
+		},
+		{
+			"non-default VCN CIDR",
+			"172.16.0.0/16",
+			SubnetPrefixLengths{},
+			[]string{"172.16.0.8/29", "172.16.0.0/29", "172.16.0.32/27", "172.16.64.0/20"},
+			"",
+		},
+		{
+			"VCN CIDR is normalized",
+			"10.1.2.3/16",
+			SubnetPrefixLengths{},
+			[]string{"10.1.0.8/29", "10.1.0.0/29", "10.1.0.32/27", "10.1.64.0/20"},
+			"",
+		},
+		{
+			"small VCN",
+			"192.168.10.0/24",
+			SubnetPrefixLengths{},
+			[]string{"192.168.10.8/29", "192.168.10.0/29", "192.168.10.32/27", "192.168.10.64/26"},
+			"",
+		},
+		{
+			"custom sizes",
+			"10.0.0.0/16",
+			SubnetPrefixLengths{ControlPlane: 28, ControlPlaneEndpoint: 30, LoadBalancer: 24, Worker: 18},
+			[]string{"10.0.0.16/30", "10.0.0.0/28", "10.0.1.0/24", "10.0.64.0/18"},
+			"",
+		},
+		{
+			"large load balancer subnet pushes the worker subnet",
+			"10.0.0.0/16",
+			SubnetPrefixLengths{LoadBalancer: 18},
+			[]string{"10.0.0.8/29", "10.0.0.0/29", "10.0.64.0/18", "10.0.128.0/20"},
+			"",
+		},
+		{
+			"worker subnet larger than a quarter of the VCN",
+			"10.0.0.0/16",
+			SubnetPrefixLengths{Worker: 17},
+			[]string{"10.0.0.8/29", "10.0.0.0/29", "10.0.0.32/27", "10.0.128.0/17"},
+			"",
+		},
+		{
+			"subnets do not fit",
+			"10.0.0.0/16",
+			SubnetPrefixLengths{LoadBalancer: 17, Worker: 17},
+			nil,
+			"worker subnet /17 does not fit in VCN 10.0.0.0/16 after the other subnets, use a larger VCN or smaller subnets",
+		},
+		{
+			"subnet larger than the VCN",
+			"10.0.0.0/24",
+			SubnetPrefixLengths{Worker: 20},
+			nil,
+			"worker subnet prefix length 20 must be between 24 and 30",
+		},
+		{
+			"VCN too small",
+			"10.0.0.0/27",
+			SubnetPrefixLengths{},
+			nil,
+			"service-lb subnet /27 does not fit in VCN 10.0.0.0/27 after the other subnets, use a larger VCN or smaller subnets",
+		},
+		{
+			"VCN too large",
+			"10.0.0.0/12",
+			SubnetPrefixLengths{},
+			nil,
+			"VCN CIDR 10.0.0.0/12 must be between /16 and /30",
+		},
+		{
+			"IPv6 VCN",
+			"fd00::/48",
+			SubnetPrefixLengths{},
+			nil,
+			"VCN CIDR fd00::/48 is not an IPv4 CIDR",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := PlanNetwork(tt.vcnCIDR, tt.prefixLengths, NetworkAccess{})
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			var cidrs []string
+			var nets []*net.IPNet
+			for _, subnet := range plan.Subnets {
+				cidrs = append(cidrs, subnet.CIDR)
+				_, n, err := net.ParseCIDR(subnet.CIDR)
+				assert.NoError(t, err)
+				nets = append(nets, n)
+			}
+			assert.Equal(t, tt.subnets, cidrs)
+
+			// subnets are inside the VCN, and never overlap
+			_, vcn, _ := net.ParseCIDR(plan.CIDR)
+			for i := range nets {
+				assert.True(t, vcn.Contains(nets[i].IP))
+				for j := i + 1; j < len(nets); j++ {
+					assert.False(t, cidrsOverlap(nets[i], nets[j]), "%s overlaps %s", nets[i], nets[j])
+				}
+			}
+
+			// every rule between nodes uses a planned CIDR
+			planned := map[string]bool{plan.CIDR: true, anywhereCIDR: true}
+			for _, cidr := range cidrs {
+				planned[cidr] = true
+			}
+			assert.Len(t, plan.NetworkSecurityGroups, 4)
+			for _, nsg := range plan.NetworkSecurityGroups {
+				for _, rule := range append(nsg.EgressRules, nsg.IngressRules...) {
+					assert.True(t, planned[rule.CIDR], "%s rule %s uses unplanned CIDR %s", nsg.Name, rule.Description, rule.CIDR)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanNetworkAccess(t *testing.T) {
+	var tests = []struct {
+		name       string
+		access     NetworkAccess
+		apiSources []string
+		sshSources []string
+	}{
+		{
+			"public",
+			NetworkAccess{},
+			[]string{"10.0.0.0/16", anywhereCIDR},
+			[]string{anywhereCIDR},
+		},
+		{
+			"private",
+			NetworkAccess{Private: true},
+			[]string{"10.0.0.0/16"},
+			[]string{"10.0.0.0/16"},
+		},
+		{
+			"private with allowed CIDRs",
+			NetworkAccess{Private: true, AllowedCIDRs: []string{"192.168.1.0/24", "172.16.0.0/12"}},
+			[]string{"10.0.0.0/16", "192.168.1.0/24", "172.16.0.0/12"},
+			[]string{"192.168.1.0/24", "172.16.0.0/12"},
+		},
+		{
+			"API and SSH allow-lists",
+			NetworkAccess{APIServerCIDRs: []string{"203.0.113.0/24", "198.51.100.7/32"}, SSHCIDRs: []string{"198.51.100.7/32"}},
+			[]string{"10.0.0.0/16", "203.0.113.0/24", "198.51.100.7/32"},
+			[]string{"198.51.100.7/32"},
+		},
+		{
+			"SSH disabled",
+			NetworkAccess{Private: true, AllowedCIDRs: []string{"192.168.1.0/24"}, SSHCIDRs: []string{SSHDisabled}},
+			[]string{"10.0.0.0/16", "192.168.1.0/24"},
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := PlanNetwork("10.0.0.0/16", SubnetPrefixLengths{}, tt.access)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.access.Private, plan.Private)
+			for _, subnet := range plan.Subnets {
+				if tt.access.Private {
+					assert.Equal(t, subnetPrivate, subnet.Type, subnet.Role)
+				}
+			}
+
+			sources := map[string][]string{}
+			for _, nsg := range plan.NetworkSecurityGroups {
+				for _, rule := range nsg.IngressRules {
+					switch rule.Description {
+					case "Kubernetes API traffic from the VCN", "External access to Kubernetes API endpoint", "Inbound SSH traffic to Control Plane", "Inbound SSH traffic to worker node":
+						sources[nsg.Role] = append(sources[nsg.Role], rule.CIDR)
+					}
+				}
+			}
+			expected := map[string][]string{
+				controlPlaneEndpointSubnetRole: tt.apiSources,
+			}
+			if tt.sshSources != nil {
+				expected[controlPlaneSubnetRole] = tt.sshSources
+				expected[workerSubnetRole] = tt.sshSources
+			}
+			assert.Equal(t, expected, sources)
+		})
+	}
+}
+
+// TestPlanNetworkAPIAllowList asserts that the nodes can still reach the Kubernetes API endpoint from the VCN when the API endpoint has an allow-list
+func TestPlanNetworkAPIAllowList(t *testing.T) {
+	for _, private := range []bool{false, true} {
+		plan, err := PlanNetwork("10.0.0.0/16", SubnetPrefixLengths{}, NetworkAccess{Private: private, APIServerCIDRs: []string{"203.0.113.0/24"}})
+		assert.NoError(t, err)
+		endpoint := plan.NetworkSecurityGroups[0]
+		assert.Equal(t, controlPlaneEndpointSubnetRole, endpoint.Role)
+		assert.Contains(t, endpoint.IngressRules, tcpRule("Kubernetes API traffic from the VCN", "10.0.0.0/16", 6443, 6443))
+		assert.Contains(t, endpoint.IngressRules, tcpRule("External access to Kubernetes API endpoint", "203.0.113.0/24", 6443, 6443))
+	}
+}
+
+func TestQuickCreateVCNCIDR(t *testing.T) {
+	v := Variables{ClusterCIDR: "10.96.0.0/16"}
+	assert.Equal(t, "10.96.0.0/16", v.QuickCreateVCNCIDR())
+	v.VCNCIDR = "10.0.0.0/16"
+	assert.Equal(t, "10.0.0.0/16", v.QuickCreateVCNCIDR())
+}
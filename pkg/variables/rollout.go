@@ -0,0 +1,119 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package variables
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultControlPlaneMaxSurge   = "1"
+	DefaultNodePoolMaxSurge       = "1"
+	DefaultNodePoolMaxUnavailable = "0"
+	// DefaultNodeDrainTimeout waits for nodes to drain without a time limit
+	DefaultNodeDrainTimeout = "0s"
+
+	// minCertificatesExpiryDays is the smallest certificate expiry the control plane accepts for rollouts
+	minCertificatesExpiryDays = 7
+	// minScaleInControlPlaneReplicas is the smallest control plane that can remove a node before creating its replacement
+	minScaleInControlPlaneReplicas = 3
+)
+
+// RolloutStrategy configures how many nodes a node pool adds and removes while it replaces its nodes
+type RolloutStrategy struct {
+	MaxSurge       *intstr.IntOrString `json:"maxSurge,omitempty"`
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// NodePoolRollout is the rollout settings of a node pool with the cluster defaults applied, for templating
+type NodePoolRollout struct {
+	MaxSurge         intstr.IntOrString
+	MaxUnavailable   intstr.IntOrString
+	MinReadySeconds  int64
+	NodeDrainTimeout string
+}
+
+// MaxSurgeValue is maxSurge as YAML, since it is either a number or a percentage
+func (rollout NodePoolRollout) MaxSurgeValue() string {
+	return intOrStringValue(rollout.MaxSurge)
+}
+
+// MaxUnavailableValue is maxUnavailable as YAML, since it is either a number or a percentage
+func (rollout NodePoolRollout) MaxUnavailableValue() string {
+	return intOrStringValue(rollout.MaxUnavailable)
+}
+
+// NodePoolRollout is the rollout settings of the node pool, using the cluster defaults for unset values
+func (v Variables) NodePoolRollout(np NodePool) NodePoolRollout {
+	rollout := NodePoolRollout{
+		MaxSurge:         intstr.Parse(valueOrDefault(v.NodePoolMaxSurge, DefaultNodePoolMaxSurge)),
+		MaxUnavailable:   intstr.Parse(valueOrDefault(v.NodePoolMaxUnavailable, DefaultNodePoolMaxUnavailable)),
+		MinReadySeconds:  v.MinReadySeconds,
+		NodeDrainTimeout: valueOrDefault(v.NodeDrainTimeout, DefaultNodeDrainTimeout),
+	}
+	if np.RolloutStrategy != nil {
+		if np.RolloutStrategy.MaxSurge != nil {
+			rollout.MaxSurge = *np.RolloutStrategy.MaxSurge
+		}
+		if np.RolloutStrategy.MaxUnavailable != nil {
+			rollout.MaxUnavailable = *np.RolloutStrategy.MaxUnavailable
+		}
+	}
+	if np.MinReadySeconds != nil {
+		rollout.MinReadySeconds = *np.MinReadySeconds
+	}
+	if np.NodeDrainTimeout != "" {
+		rollout.NodeDrainTimeout = np.NodeDrainTimeout
+	}
+	return rollout
+}
+
+// ControlPlaneMaxSurgeValue is the number of control plane nodes created before an old node is removed, 0 or 1
+func (v Variables) ControlPlaneMaxSurgeValue() string {
+	return intOrStringValue(intstr.Parse(valueOrDefault(v.ControlPlaneMaxSurge, DefaultControlPlaneMaxSurge)))
+}
+
+// ControlPlaneNodeDrainTimeout is the node drain timeout of control plane nodes
+func (v Variables) ControlPlaneNodeDrainTimeout() string {
+	return valueOrDefault(v.NodeDrainTimeout, DefaultNodeDrainTimeout)
+}
+
+func intOrStringValue(value intstr.IntOrString) string {
+	if value.Type == intstr.String {
+		return strconv.Quote(value.StrVal)
+	}
+	return value.String()
+}
+
+// scaledIntOrPercent is the value, with percentages of 100, and whether it is a non-negative number or percentage
+func scaledIntOrPercent(value intstr.IntOrString, roundUp bool) (int, bool) {
+	scaled, err := intstr.GetScaledValueFromIntOrPercent(&value, 100, roundUp)
+	return scaled, err == nil && scaled >= 0
+}
+
+// validate reports every problem with the rollout settings, as messages prefixed with the owner name
+func (rollout NodePoolRollout) validate(owner string) []string {
+	var problems []string
+	surge, surgeOK := scaledIntOrPercent(rollout.MaxSurge, true)
+	if !surgeOK {
+		problems = append(problems, fmt.Sprintf("%s maxSurge '%s' must be a number or a percentage", owner, rollout.MaxSurge.String()))
+	}
+	unavailable, unavailableOK := scaledIntOrPercent(rollout.MaxUnavailable, false)
+	if !unavailableOK {
+		problems = append(problems, fmt.Sprintf("%s maxUnavailable '%s' must be a number or a percentage", owner, rollout.MaxUnavailable.String()))
+	}
+	if surgeOK && unavailableOK && surge == 0 && unavailable == 0 {
+		problems = append(problems, fmt.Sprintf("%s maxSurge and maxUnavailable cannot both be 0", owner))
+	}
+	if rollout.MinReadySeconds < 0 {
+		problems = append(problems, fmt.Sprintf("%s minReadySeconds %d cannot be negative", owner, rollout.MinReadySeconds))
+	}
+	if _, err := time.ParseDuration(rollout.NodeDrainTimeout); err != nil {
+		problems = append(problems, fmt.Sprintf("%s nodeDrainTimeout '%s' is not a valid duration", owner, rollout.NodeDrainTimeout))
+	}
+	return problems
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package variables
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const (
+	// ScalingPolicyFirst scales the first node pool, leaving the other node pools unchanged
+	ScalingPolicyFirst = "first"
+	// ScalingPolicyProportional scales every node pool in proportion to its current size
+	ScalingPolicyProportional = "proportional"
+	// ScalingPolicyScalable scales the node pools marked as scalable, in proportion to their current size
+	ScalingPolicyScalable = "scalable"
+
+	DefaultScalingPolicy = ScalingPolicyFirst
+)
+
+// SetClusterSize distributes the requested total node count across the node pools, according to the node pool scaling policy.
+// The control plane replicas are part of the total node count, and are not changed by scaling.
+func (v *Variables) SetClusterSize(count int64) error {
+	nodePools, err := v.ParseNodePools()
+	if err != nil {
+		return err
+	}
+	// keep the values looked up from OCI
+	for i := range nodePools {
+		for _, np := range v.NodePools {
+			if np.Name == nodePools[i].Name {
+				nodePools[i].ActualImage = np.ActualImage
+			}
+		}
+	}
+	workers := count - v.ControlPlaneReplicas
+	if workers < 0 {
+		return fmt.Errorf("cannot scale cluster to %d nodes, the cluster has %d control plane nodes", count, v.ControlPlaneReplicas)
+	}
+	if len(nodePools) < 1 {
+		if workers > 0 {
+			return fmt.Errorf("cannot scale cluster to %d nodes, the cluster has no node pools", count)
+		}
+		return nil
+	}
+
+	var scaled []int
+	switch v.NodePoolScalingPolicy {
+	case ScalingPolicyFirst, "":
+		scaled = []int{0}
+	case ScalingPolicyProportional:
+		for i := range nodePools {
+			scaled = append(scaled, i)
+		}
+	case ScalingPolicyScalable:
+		for i, np := range nodePools {
+			if np.Scalable {
+				scaled = append(scaled, i)
+			}
+		}
+		if len(scaled) < 1 {
+			return fmt.Errorf("cannot scale cluster to %d nodes, no node pools are marked as scalable", count)
+		}
+	default:
+		return fmt.Errorf("unknown node pool scaling policy %s", v.NodePoolScalingPolicy)
+	}
+
+	// The replicas of node pools that are not scaled are fixed
+	isScaled := map[int]bool{}
+	for _, i := range scaled {
+		if nodePools[i].IsAutoscaled() {
+			return fmt.Errorf("cannot scale node pool %s, it is managed by the cluster autoscaler", nodePools[i].Name)
+		}
+		isScaled[i] = true
+	}
+	remaining := workers
+	for i, np := range nodePools {
+		if !isScaled[i] {
+			remaining -= np.Replicas
+		}
+	}
+	if remaining < 0 {
+		return fmt.Errorf("cannot scale cluster to %d nodes, node pools that are not scalable already have %d nodes", count, workers-remaining)
+	}
+
+	var current []int64
+	for _, i := range scaled {
+		current = append(current, nodePools[i].Replicas)
+	}
+	for idx, replicas := range distribute(remaining, current) {
+		nodePools[scaled[idx]].Replicas = replicas
+	}
+	return v.SetNodePools(nodePools)
+}
+
+// SetNodePools sets the node pools, keeping the serialized node pools and node pool hashes in sync
+func (v *Variables) SetNodePools(nodePools []NodePool) error {
+	var rawNodePools []string
+	for _, np := range nodePools {
+		// looked up and computed values are not part of the node pool configuration
+		np.ActualImage = ""
+		np.Hash = ""
+		rawNodePool, err := json.Marshal(np)
+		if err != nil {
+			return err
+		}
+		rawNodePools = append(rawNodePools, string(rawNodePool))
+	}
+	v.NodePools = nodePools
+	v.RawNodePools = rawNodePools
+	v.SetNodePoolHash()
+	return nil
+}
+
+// distribute splits total in proportion to weights, using the largest remainder method.
+// If all weights are zero, total is split evenly.
+func distribute(total int64, weights []int64) []int64 {
+	result := make([]int64, len(weights))
+	if len(weights) < 1 {
+		return result
+	}
+	var sum int64
+	for _, w := range weights {
+		sum += w
+	}
+	if sum == 0 {
+		weights = make([]int64, len(weights))
+		for i := range weights {
+			weights[i] = 1
+		}
+		sum = int64(len(weights))
+	}
+
+	type remainder struct {
+		idx       int
+		remainder int64
+	}
+	var remainders []remainder
+	var assigned int64
+	for i, w := range weights {
+		result[i] = total * w / sum
+		assigned += result[i]
+		remainders = append(remainders, remainder{idx: i, remainder: total * w % sum})
+	}
+	sort.SliceStable(remainders, func(i, j int) bool {
+		return remainders[i].remainder > remainders[j].remainder
+	})
+	for i := int64(0); i < total-assigned; i++ {
+		result[remainders[i].idx]++
+	}
+	return result
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package variables
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func testNodePools(replicas ...int64) []string {
+	var rawNodePools []string
+	for i, r := range replicas {
+		b, _ := json.Marshal(NodePool{
+			Name:     string(rune('a' + i)),
+			Replicas: r,
+			Scalable: i > 0,
+		})
+		rawNodePools = append(rawNodePools, string(b))
+	}
+	return rawNodePools
+}
+
+func TestSetClusterSize(t *testing.T) {
+	var tests = []struct {
+		name     string
+		policy   string
+		replicas []int64
+		count    int64
+		expected []int64
+		hasError bool
+	}{
+		{
+			"first pool is scaled by default",
+			"",
+			[]int64{1, 2},
+			6,
+			[]int64{3, 2},
+			false,
+		},
+		{
+			"first pool cannot be scaled below zero",
+			ScalingPolicyFirst,
+			[]int64{1, 4},
+			3,
+			nil,
+			true,
+		},
+		{
+			"proportional scale up",
+			ScalingPolicyProportional,
+			[]int64{1, 3},
+			9,
+			[]int64{2, 6},
+			false,
+		},
+		{
+			"proportional scale down with remainders",
+			ScalingPolicyProportional,
+			[]int64{2, 2, 2},
+			5,
+			[]int64{2, 1, 1},
+			false,
+		},
+		{
+			"proportional scale of empty pools",
+			ScalingPolicyProportional,
+			[]int64{0, 0},
+			5,
+			[]int64{2, 2},
+			false,
+		},
+		{
+			"scalable pools are scaled",
+			ScalingPolicyScalable,
+			[]int64{1, 1, 1},
+			8,
+			[]int64{1, 3, 3},
+			false,
+		},
+		{
+			"no scalable pools",
+			ScalingPolicyScalable,
+			[]int64{1},
+			8,
+			nil,
+			true,
+		},
+		{
+			"fewer nodes than control plane replicas",
+			ScalingPolicyFirst,
+			[]int64{1},
+			0,
+			nil,
+			true,
+		},
+		{
+			"no node pools",
+			ScalingPolicyFirst,
+			nil,
+			2,
+			nil,
+			true,
+		},
+		{
+			"no node pools and only control plane nodes",
+			ScalingPolicyFirst,
+			nil,
+			1,
+			nil,
+			false,
+		},
+		{
+			"unknown policy",
+			"xyz",
+			[]int64{1},
+			3,
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Variables{
+				ControlPlaneReplicas:  1,
+				NodePoolScalingPolicy: tt.policy,
+				RawNodePools:          testNodePools(tt.replicas...),
+			}
+			err := v.SetClusterSize(tt.count)
+			if tt.hasError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			var actual []int64
+			for _, np := range v.NodePools {
+				actual = append(actual, np.Replicas)
+			}
+			assert.Equal(t, tt.expected, actual)
+
+			// The serialized node pools are in sync with the parsed node pools
+			nps, err := v.ParseNodePools()
+			assert.NoError(t, err)
+			assert.Len(t, nps, len(v.NodePools))
+			for i := range nps {
+				assert.Equal(t, v.NodePools[i].Replicas, nps[i].Replicas)
+				assert.NotEmpty(t, v.NodePools[i].Hash)
+				assert.Empty(t, nps[i].Hash)
+			}
+			nc, err := v.NodeCount()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.count, nc.Count)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package variables
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// StateSchemaVersion is the schema version of the driver state written by this driver.
+// Increment it and register a migration whenever a persisted field is renamed, removed, or changes type.
+const StateSchemaVersion = 1
+
+const schemaVersionField = "SchemaVersion"
+
+// stateMigration upgrades the raw driver state by one schema version
+type stateMigration func(state map[string]json.RawMessage) error
+
+// stateMigrations are indexed by the schema version they upgrade from
+var stateMigrations = []stateMigration{
+	// 0: unversioned state, which included the OCI credentials and a single node pool hash
+	migrateUnversionedState,
+}
+
+// LoadState loads Variables from the persisted driver state, migrating state written by older driver versions.
+// If the state must be rewritten, migrated is true.
+func LoadState(state string) (v *Variables, migrated bool, err error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(state), &fields); err != nil {
+		return nil, false, err
+	}
+	schemaVersion := 0
+	if raw, ok := fields[schemaVersionField]; ok {
+		if err := json.Unmarshal(raw, &schemaVersion); err != nil {
+			return nil, false, fmt.Errorf("invalid driver state schema version: %v", err)
+		}
+	}
+	if schemaVersion > StateSchemaVersion {
+		return nil, false, fmt.Errorf("driver state schema version %d is newer than the supported schema version %d, upgrade the driver", schemaVersion, StateSchemaVersion)
+	}
+
+	for ; schemaVersion < StateSchemaVersion; schemaVersion++ {
+		if err := stateMigrations[schemaVersion](fields); err != nil {
+			return nil, false, fmt.Errorf("failed to migrate driver state from schema version %d: %v", schemaVersion, err)
+		}
+		migrated = true
+	}
+	fields[schemaVersionField] = json.RawMessage(fmt.Sprintf("%d", StateSchemaVersion))
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, false, err
+	}
+	v = &Variables{}
+	if err := json.Unmarshal(b, v); err != nil {
+		return nil, false, err
+	}
+	v.ExistingControlPlaneReplicas = v.ControlPlaneReplicas
+	return v, migrated, nil
+}
+
+// State is the persisted driver state of the Variables, without credentials
+func (v *Variables) State() (string, error) {
+	v.SchemaVersion = StateSchemaVersion
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// migrateUnversionedState scrubs the OCI credentials, which are now loaded from the cloud credential,
+// and removes the cluster wide node pool hash, which is now set per node pool.
+func migrateUnversionedState(state map[string]json.RawMessage) error {
+	for _, field := range []string{
+		"Fingerprint",
+		"PrivateKey",
+		"PrivateKeyPassphrase",
+		"Tenancy",
+		"User",
+		"NodePoolHash",
+	} {
+		delete(state, field)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package variables
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestStateMigrations(t *testing.T) {
+	// every schema version before the current one needs a migration
+	assert.Len(t, stateMigrations, StateSchemaVersion)
+}
+
+func TestLoadStateFixtures(t *testing.T) {
+	var tests = []struct {
+		fixture  string
+		migrated bool
+		check    func(t *testing.T, v *Variables)
+	}{
+		{
+			"testdata/state-v0.json",
+			true,
+			func(t *testing.T, v *Variables) {
+				assert.Empty(t, v.NodePools[0].Hash)
+			},
+		},
+		{
+			"testdata/state-v1.json",
+			false,
+			func(t *testing.T, v *Variables) {
+				assert.Equal(t, "fghij", v.NodePools[0].Hash)
+				assert.Equal(t, AuthModeUserPrincipal, v.AuthMode)
+				assert.Equal(t, ScalingPolicyFirst, v.NodePoolScalingPolicy)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			b, err := os.ReadFile(tt.fixture)
+			assert.NoError(t, err)
+			v, migrated, err := LoadState(string(b))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.migrated, migrated)
+			assert.Equal(t, StateSchemaVersion, v.SchemaVersion)
+
+			// values common to every schema version
+			assert.Equal(t, "test", v.Name)
+			assert.Equal(t, "v1.25.7", v.KubernetesVersion)
+			assert.Equal(t, "cattle-global-data:cc-abcde", v.CloudCredentialId)
+			assert.Equal(t, "ocid1.image.oc1.iad.aaa", v.ActualImage)
+			assert.Len(t, v.NodePools, 1)
+			assert.Equal(t, "np-1", v.NodePools[0].Name)
+			assert.Empty(t, v.PrivateKey)
+			assert.Empty(t, v.Fingerprint)
+			assert.Empty(t, v.Tenancy)
+			assert.Equal(t, int64(1), v.ExistingControlPlaneReplicas)
+			assert.Empty(t, v.User)
+			tt.check(t, v)
+
+			// round trip through the current schema
+			state, err := v.State()
+			assert.NoError(t, err)
+			assert.NotContains(t, state, "PrivateKey")
+			assert.NotContains(t, state, "NodePoolHash")
+			reloaded, migrated, err := LoadState(state)
+			assert.NoError(t, err)
+			assert.False(t, migrated)
+			assert.Equal(t, v, reloaded)
+		})
+	}
+}
+
+func TestStateExcludesCredentials(t *testing.T) {
+	v := &Variables{
+		Name:                 "test",
+		CloudCredentialId:    "cattle-global-data:creds",
+		Fingerprint:          "fingerprint",
+		PrivateKey:           "private-key",
+		PrivateKeyPassphrase: "passphrase",
+		Tenancy:              "tenancy",
+		User:                 "user",
+	}
+	state, err := v.State()
+	assert.NoError(t, err)
+	for _, s := range []string{"fingerprint", "private-key", "passphrase", "tenancy", `"user"`} {
+		assert.NotContains(t, state, s)
+	}
+}
+
+func TestLoadStateErrors(t *testing.T) {
+	_, _, err := LoadState("not json")
+	assert.Error(t, err)
+
+	_, _, err = LoadState(fmt.Sprintf(`{"SchemaVersion":%d,"Name":"test"}`, StateSchemaVersion+1))
+	assert.EqualError(t, err, fmt.Sprintf("driver state schema version %d is newer than the supported schema version %d, upgrade the driver", StateSchemaVersion+1, StateSchemaVersion))
+
+	_, _, err = LoadState(`{"SchemaVersion":"one"}`)
+	assert.Error(t, err)
+}
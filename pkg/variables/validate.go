@@ -0,0 +1,318 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package variables
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	driverconst "github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/constants"
+	"k8s.io/apimachinery/pkg/api/validation/path"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"net"
+	"strings"
+	"time"
+)
+
+// OptionError is a problem with a single driver option
+type OptionError struct {
+	Key     string
+	Message string
+}
+
+// ValidationError is every problem found with the driver options
+type ValidationError struct {
+	Errors []OptionError
+}
+
+func (e *ValidationError) Error() string {
+	var problems []string
+	for _, err := range e.Errors {
+		problems = append(problems, fmt.Sprintf("%s: %s", err.Key, err.Message))
+	}
+	return fmt.Sprintf("invalid cluster options: %s", strings.Join(problems, "; "))
+}
+
+func (e *ValidationError) add(key, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, OptionError{
+		Key:     key,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Validate checks the driver options, before any cluster resources are created.
+// All problems are returned together in a *ValidationError.
+func (v *Variables) Validate() error {
+	verr := &ValidationError{}
+	switch v.AuthMode {
+	case "", AuthModeUserPrincipal, AuthModeInstancePrincipal, AuthModeWorkloadIdentity:
+	default:
+		verr.add(driverconst.AuthMode, "unknown authentication mode %s", v.AuthMode)
+	}
+	v.validateNetwork(verr)
+	v.validateControlPlane(verr)
+	v.validateNodePools(verr)
+	v.validateMachineHealthCheckDefaults(verr)
+	v.validateRollout(verr)
+	v.validateServiceAccount(verr)
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func (v *Variables) validateNetwork(verr *ValidationError) {
+	podNet := parseCIDR(verr, driverconst.PodCIDR, v.PodCIDR)
+	clusterNet := parseCIDR(verr, driverconst.ClusterCIDR, v.ClusterCIDR)
+	if podNet != nil && clusterNet != nil && cidrsOverlap(podNet, clusterNet) {
+		verr.add(driverconst.PodCIDR, "%s overlaps with %s %s", v.PodCIDR, driverconst.ClusterCIDR, v.ClusterCIDR)
+	}
+	// the allowed CIDRs are rules of the Quick Create network security groups
+	if len(v.AllowedCIDRs) > 0 {
+		switch {
+		case !v.PrivateCluster:
+			verr.add(driverconst.AllowedCIDRs, "allowed CIDRs only apply to private clusters")
+		case !v.QuickCreateVCN:
+			verr.add(driverconst.AllowedCIDRs, "allowed CIDRs only apply to Quick Create VCNs")
+		}
+	}
+	for _, cidr := range v.AllowedCIDRs {
+		parseCIDR(verr, driverconst.AllowedCIDRs, cidr)
+	}
+	v.validateAllowLists(verr)
+	if v.QuickCreateVCN {
+		v.validateQuickCreateNetwork(verr, podNet, clusterNet)
+		// Quick Create VCNs have their own network security groups
+		for _, nsg := range []struct {
+			key string
+			id  string
+		}{
+			{driverconst.ControlPlaneNSG, v.ControlPlaneNSG},
+			{driverconst.ControlPlaneEndpointNSG, v.ControlPlaneEndpointNSG},
+			{driverconst.WorkerNodeNSG, v.WorkerNodeNSG},
+		} {
+			if nsg.id != "" {
+				verr.add(nsg.key, "network security groups only apply to existing VCNs")
+			}
+		}
+	}
+}
+
+// validateAllowLists checks the API endpoint and SSH allow-lists, which are rules of the Quick Create network security groups
+func (v *Variables) validateAllowLists(verr *ValidationError) {
+	if !v.QuickCreateVCN {
+		if len(v.APIServerAllowedCIDRs) > 0 {
+			verr.add(driverconst.APIServerCIDRs, "allowed CIDRs only apply to Quick Create VCNs")
+		}
+		if len(v.SSHAllowedCIDRs) > 0 {
+			verr.add(driverconst.SSHCIDRs, "allowed CIDRs only apply to Quick Create VCNs")
+		}
+		return
+	}
+	for _, cidr := range v.APIServerAllowedCIDRs {
+		parseCIDR(verr, driverconst.APIServerCIDRs, cidr)
+	}
+	if v.NetworkAccess().SSHDisabled() {
+		return
+	}
+	for _, cidr := range v.SSHAllowedCIDRs {
+		if cidr == SSHDisabled {
+			verr.add(driverconst.SSHCIDRs, "%s cannot be combined with CIDRs", SSHDisabled)
+			continue
+		}
+		parseCIDR(verr, driverconst.SSHCIDRs, cidr)
+	}
+}
+
+func (v *Variables) validateQuickCreateNetwork(verr *ValidationError, podNet, clusterNet *net.IPNet) {
+	// without a VCN CIDR, the VCN uses the cluster CIDR, which is checked with the other network options
+	if v.VCNCIDR == "" && clusterNet == nil {
+		return
+	}
+	if v.VCNCIDR != "" && parseCIDR(verr, driverconst.VcnCIDR, v.VCNCIDR) == nil {
+		return
+	}
+	valid := true
+	for _, prefixLength := range []struct {
+		key   string
+		value int64
+	}{
+		{driverconst.ControlPlaneSubnetPrefixLength, v.ControlPlaneSubnetPrefixLength},
+		{driverconst.ControlPlaneEndpointSubnetPrefixLength, v.ControlPlaneEndpointSubnetPrefixLength},
+		{driverconst.LoadBalancerSubnetPrefixLength, v.LoadBalancerSubnetPrefixLength},
+		{driverconst.WorkerSubnetPrefixLength, v.WorkerSubnetPrefixLength},
+	} {
+		if prefixLength.value != 0 && (prefixLength.value < minVCNPrefixLength || prefixLength.value > maxSubnetPrefixLength) {
+			verr.add(prefixLength.key, "prefix length %d must be between %d and %d", prefixLength.value, minVCNPrefixLength, maxSubnetPrefixLength)
+			valid = false
+		}
+	}
+	if !valid {
+		return
+	}
+	plan, err := v.QuickCreateNetwork()
+	if err != nil {
+		verr.add(driverconst.VcnCIDR, "%v", err)
+		return
+	}
+	// pod traffic is routed over the VCN, so pod addresses cannot be VCN addresses
+	_, vcnNet, _ := net.ParseCIDR(plan.CIDR)
+	if podNet != nil && cidrsOverlap(podNet, vcnNet) {
+		verr.add(driverconst.PodCIDR, "%s overlaps with the VCN CIDR %s", v.PodCIDR, plan.CIDR)
+	}
+}
+
+func parseCIDR(verr *ValidationError, key, cidr string) *net.IPNet {
+	if cidr == "" {
+		verr.add(key, "CIDR is required")
+		return nil
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		verr.add(key, "%s is not a valid CIDR", cidr)
+		return nil
+	}
+	return ipNet
+}
+
+func (v *Variables) validateControlPlane(verr *ValidationError) {
+	// existing clusters may keep an even number of control plane nodes, but cannot be resized to one
+	if v.ControlPlaneReplicas < 1 {
+		verr.add(driverconst.NumControlPlaneNodes, "at least one control plane node is required")
+	} else if v.ControlPlaneReplicas%2 == 0 && v.ControlPlaneReplicas != v.ExistingControlPlaneReplicas {
+		verr.add(driverconst.NumControlPlaneNodes, "%d control plane nodes cannot maintain etcd quorum, use an odd number of nodes", v.ControlPlaneReplicas)
+	}
+	// the control plane OCPU option always has a value, so only a non-default value is an error
+	if !isFlexShape(v.ControlPlaneShape) && v.ControlPlaneOCPUs != 0 && v.ControlPlaneOCPUs != DefaultOCICPUs {
+		verr.add(driverconst.ControlPlaneOCPUs, "OCPUs can only be set for Flex shapes, %s is not a Flex shape", v.ControlPlaneShape)
+	}
+}
+
+func (v *Variables) validateNodePools(verr *ValidationError) {
+	switch v.NodePoolScalingPolicy {
+	case "", ScalingPolicyFirst, ScalingPolicyProportional, ScalingPolicyScalable:
+	default:
+		verr.add(driverconst.NodePoolScalingPolicy, "unknown node pool scaling policy %s", v.NodePoolScalingPolicy)
+	}
+
+	names := map[string]bool{}
+	for i, rawNodePool := range v.RawNodePools {
+		np := NodePool{}
+		decoder := json.NewDecoder(bytes.NewReader([]byte(rawNodePool)))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&np); err != nil {
+			verr.add(driverconst.RawNodePools, "node pool %d is invalid: %v", i, err)
+			continue
+		}
+		if names[np.Name] {
+			verr.add(driverconst.RawNodePools, "node pool name %s is used more than once", np.Name)
+		}
+		names[np.Name] = true
+		for _, msg := range validation.IsDNS1123Label(np.Name) {
+			verr.add(driverconst.RawNodePools, "node pool name '%s' is invalid: %s", np.Name, msg)
+		}
+		if !isFlexShape(np.Shape) && np.Ocpus > 0 {
+			verr.add(driverconst.RawNodePools, "node pool %s sets OCPUs, but %s is not a Flex shape", np.Name, np.Shape)
+		}
+		if np.IsAutoscaled() {
+			if np.MinReplicas > np.MaxReplicas {
+				verr.add(driverconst.RawNodePools, "node pool %s minReplicas %d is greater than maxReplicas %d", np.Name, np.MinReplicas, np.MaxReplicas)
+			} else if np.Replicas < np.MinReplicas || np.Replicas > np.MaxReplicas {
+				// the autoscaler does not move a node pool into its range
+				verr.add(driverconst.RawNodePools, "node pool %s replicas %d is outside of minReplicas %d and maxReplicas %d", np.Name, np.Replicas, np.MinReplicas, np.MaxReplicas)
+			}
+		}
+		if np.MachineHealthCheck != nil {
+			for _, msg := range np.MachineHealthCheck.validate(fmt.Sprintf("node pool %s machine health check", np.Name)) {
+				verr.add(driverconst.RawNodePools, msg)
+			}
+		}
+		if np.RolloutStrategy != nil || np.MinReadySeconds != nil || np.NodeDrainTimeout != "" {
+			// the cluster rollout defaults are validated separately, so the overrides are checked with the driver defaults
+			for _, msg := range (Variables{}).NodePoolRollout(np).validate(fmt.Sprintf("node pool %s", np.Name)) {
+				verr.add(driverconst.RawNodePools, msg)
+			}
+		}
+		for _, taint := range np.Taints {
+			switch taint.Effect {
+			case "NoSchedule", "PreferNoSchedule", "NoExecute":
+			default:
+				verr.add(driverconst.RawNodePools, "node pool %s taint %s has unknown effect '%s'", np.Name, taint.Key, taint.Effect)
+			}
+		}
+	}
+}
+
+func (v *Variables) validateServiceAccount(verr *ValidationError) {
+	if v.ServiceAccountNamespace != "" {
+		for _, msg := range validation.IsDNS1123Label(v.ServiceAccountNamespace) {
+			verr.add(driverconst.ServiceAccountNamespace, "namespace '%s' is invalid: %s", v.ServiceAccountNamespace, msg)
+		}
+	}
+	for _, msg := range path.IsValidPathSegmentName(v.ServiceAccountClusterRole) {
+		verr.add(driverconst.ServiceAccountClusterRole, "cluster role '%s' is invalid: %s", v.ServiceAccountClusterRole, msg)
+	}
+}
+
+func (v *Variables) validateMachineHealthCheckDefaults(verr *ValidationError) {
+	for _, defaults := range []struct {
+		key string
+		mhc MachineHealthCheck
+	}{
+		{driverconst.MachineHealthCheckMaxUnhealthy, MachineHealthCheck{MaxUnhealthy: v.MachineHealthCheckMaxUnhealthy}},
+		{driverconst.MachineHealthCheckNodeStartupTimeout, MachineHealthCheck{NodeStartupTimeout: v.MachineHealthCheckNodeStartupTimeout}},
+	} {
+		for _, msg := range defaults.mhc.validate("machine health check") {
+			verr.add(defaults.key, msg)
+		}
+	}
+	if v.MachineHealthCheckUnhealthyTimeout != "" {
+		if _, err := time.ParseDuration(v.MachineHealthCheckUnhealthyTimeout); err != nil {
+			verr.add(driverconst.MachineHealthCheckUnhealthyTimeout, "'%s' is not a valid duration", v.MachineHealthCheckUnhealthyTimeout)
+		}
+	}
+}
+
+func (v *Variables) validateRollout(verr *ValidationError) {
+	switch v.ControlPlaneMaxSurgeValue() {
+	case "0":
+		if v.ControlPlaneReplicas < minScaleInControlPlaneReplicas {
+			verr.add(driverconst.ControlPlaneMaxSurge, "a max surge of 0 requires at least %d control plane nodes", minScaleInControlPlaneReplicas)
+		}
+	case "1":
+	default:
+		verr.add(driverconst.ControlPlaneMaxSurge, "max surge must be 0 or 1, not '%s'", v.ControlPlaneMaxSurge)
+	}
+	if v.ControlPlaneRolloutAfter != "" {
+		if _, err := time.Parse(time.RFC3339, v.ControlPlaneRolloutAfter); err != nil {
+			verr.add(driverconst.ControlPlaneRolloutAfter, "'%s' is not an RFC 3339 time", v.ControlPlaneRolloutAfter)
+		}
+	}
+	if v.ControlPlaneRolloutBeforeCertificatesExpiryDays != 0 && v.ControlPlaneRolloutBeforeCertificatesExpiryDays < minCertificatesExpiryDays {
+		verr.add(driverconst.ControlPlaneRolloutBeforeCertificatesExpiryDays, "must be at least %d days", minCertificatesExpiryDays)
+	}
+
+	defaults := v.NodePoolRollout(NodePool{})
+	surge, surgeOK := scaledIntOrPercent(defaults.MaxSurge, true)
+	if !surgeOK {
+		verr.add(driverconst.NodePoolMaxSurge, "'%s' must be a number or a percentage", v.NodePoolMaxSurge)
+	}
+	unavailable, unavailableOK := scaledIntOrPercent(defaults.MaxUnavailable, false)
+	if !unavailableOK {
+		verr.add(driverconst.NodePoolMaxUnavailable, "'%s' must be a number or a percentage", v.NodePoolMaxUnavailable)
+	}
+	if surgeOK && unavailableOK && surge == 0 && unavailable == 0 {
+		verr.add(driverconst.NodePoolMaxSurge, "max surge and %s cannot both be 0", driverconst.NodePoolMaxUnavailable)
+	}
+	if v.MinReadySeconds < 0 {
+		verr.add(driverconst.MinReadySeconds, "%d cannot be negative", v.MinReadySeconds)
+	}
+	if _, err := time.ParseDuration(defaults.NodeDrainTimeout); err != nil {
+		verr.add(driverconst.NodeDrainTimeout, "'%s' is not a valid duration", v.NodeDrainTimeout)
+	}
+}
+
+func isFlexShape(shape string) bool {
+	return strings.Contains(shape, "Flex")
+}
@@ -0,0 +1,355 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package variables
+
+import (
+	"github.com/rancher/kontainer-engine/types"
+	"github.com/stretchr/testify/assert"
+	driverconst "github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/constants"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/oci"
+	"testing"
+)
+
+func validVariables() *Variables {
+	return &Variables{
+		PodCIDR:              "192.168.0.0/16",
+		ClusterCIDR:          "10.96.0.0/12",
+		ControlPlaneReplicas: 3,
+		ControlPlaneShape:    DefaultVMShape,
+		ControlPlaneOCPUs:    4,
+		RawNodePools: []string{
+			`{"name":"np-1","replicas":3,"memory":32,"ocpus":2,"volumeSize":100,"shape":"VM.Standard.E4.Flex"}`,
+			`{"name":"np-2","replicas":1,"memory":32,"volumeSize":100,"shape":"VM.Standard2.4","taints":[{"key":"a","effect":"NoSchedule"}]}`,
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var tests = []struct {
+		name   string
+		modify func(v *Variables)
+		keys   []string
+	}{
+		{
+			"valid options",
+			func(v *Variables) {},
+			nil,
+		},
+		{
+			"malformed CIDRs",
+			func(v *Variables) {
+				v.PodCIDR = "192.168.0.0"
+				v.ClusterCIDR = ""
+			},
+			[]string{driverconst.PodCIDR, driverconst.ClusterCIDR},
+		},
+		{
+			"overlapping CIDRs",
+			func(v *Variables) {
+				v.ClusterCIDR = "192.168.128.0/20"
+			},
+			[]string{driverconst.PodCIDR},
+		},
+		{
+			"no control plane nodes",
+			func(v *Variables) {
+				v.ControlPlaneReplicas = 0
+			},
+			[]string{driverconst.NumControlPlaneNodes},
+		},
+		{
+			"even control plane nodes",
+			func(v *Variables) {
+				v.ControlPlaneReplicas = 2
+			},
+			[]string{driverconst.NumControlPlaneNodes},
+		},
+		{
+			"existing cluster with even control plane nodes",
+			func(v *Variables) {
+				v.ExistingControlPlaneReplicas = 2
+				v.ControlPlaneReplicas = 2
+			},
+			nil,
+		},
+		{
+			"existing cluster resized to even control plane nodes",
+			func(v *Variables) {
+				v.ExistingControlPlaneReplicas = 3
+				v.ControlPlaneReplicas = 4
+			},
+			[]string{driverconst.NumControlPlaneNodes},
+		},
+		{
+			"control plane OCPUs on a fixed shape",
+			func(v *Variables) {
+				v.ControlPlaneShape = "VM.Standard2.4"
+			},
+			[]string{driverconst.ControlPlaneOCPUs},
+		},
+		{
+			"default control plane OCPUs on a fixed shape",
+			func(v *Variables) {
+				v.ControlPlaneShape = "VM.Standard2.4"
+				v.ControlPlaneOCPUs = DefaultOCICPUs
+			},
+			nil,
+		},
+		{
+			"node pool problems",
+			func(v *Variables) {
+				v.NodePoolScalingPolicy = "largest"
+				v.RawNodePools = []string{
+					`{"name":"np-1","shape":"VM.Standard2.4","ocpus":2}`,
+					`{"name":"np-1","shape":"VM.Standard.E4.Flex"}`,
+					`{"name":"NP_2","shape":"VM.Standard.E4.Flex"}`,
+					`{"name":"np-3","shape":"VM.Standard.E4.Flex","cpus":2}`,
+					`{"name":"np-4","shape":"VM.Standard.E4.Flex","minReplicas":3,"maxReplicas":2}`,
+					`{"name":"np-5","shape":"VM.Standard.E4.Flex","taints":[{"key":"a","effect":"Never"}]}`,
+					`{"name":`,
+				}
+			},
+			[]string{
+				driverconst.NodePoolScalingPolicy,
+				driverconst.RawNodePools,
+				driverconst.RawNodePools,
+				driverconst.RawNodePools,
+				driverconst.RawNodePools,
+				driverconst.RawNodePools,
+				driverconst.RawNodePools,
+				driverconst.RawNodePools,
+			},
+		},
+		{
+			"autoscaled node pool replicas",
+			func(v *Variables) {
+				v.RawNodePools = []string{
+					`{"name":"np-1","shape":"VM.Standard.E4.Flex","replicas":2,"minReplicas":1,"maxReplicas":3}`,
+					`{"name":"np-2","shape":"VM.Standard.E4.Flex","replicas":0,"minReplicas":1,"maxReplicas":3}`,
+					`{"name":"np-3","shape":"VM.Standard.E4.Flex","replicas":4,"minReplicas":1,"maxReplicas":3}`,
+				}
+			},
+			[]string{
+				driverconst.RawNodePools,
+				driverconst.RawNodePools,
+			},
+		},
+		{
+			"quick create VCN",
+			func(v *Variables) {
+				v.QuickCreateVCN = true
+				v.VCNCIDR = "10.0.0.0/16"
+				v.WorkerSubnetPrefixLength = 18
+			},
+			nil,
+		},
+		{
+			"quick create VCN overlaps pod CIDR",
+			func(v *Variables) {
+				v.QuickCreateVCN = true
+				v.VCNCIDR = "192.168.0.0/20"
+			},
+			[]string{driverconst.PodCIDR},
+		},
+		{
+			"private cluster",
+			func(v *Variables) {
+				v.QuickCreateVCN = true
+				v.VCNCIDR = "10.0.0.0/16"
+				v.PrivateCluster = true
+				v.AllowedCIDRs = []string{"10.1.0.0/16"}
+			},
+			nil,
+		},
+		{
+			"invalid allowed CIDRs",
+			func(v *Variables) {
+				v.AllowedCIDRs = []string{"10.1.0.0"}
+			},
+			[]string{driverconst.AllowedCIDRs, driverconst.AllowedCIDRs},
+		},
+		{
+			"allowed CIDRs without quick create VCN",
+			func(v *Variables) {
+				v.PrivateCluster = true
+				v.AllowedCIDRs = []string{"10.1.0.0/16"}
+			},
+			[]string{driverconst.AllowedCIDRs},
+		},
+		{
+			"API and SSH allow-lists",
+			func(v *Variables) {
+				v.QuickCreateVCN = true
+				v.VCNCIDR = "10.0.0.0/16"
+				v.APIServerAllowedCIDRs = []string{"203.0.113.0/24"}
+				v.SSHAllowedCIDRs = []string{SSHDisabled}
+			},
+			nil,
+		},
+		{
+			"invalid API and SSH allow-lists",
+			func(v *Variables) {
+				v.QuickCreateVCN = true
+				v.VCNCIDR = "10.0.0.0/16"
+				v.APIServerAllowedCIDRs = []string{"203.0.113.0/24", "none"}
+				v.SSHAllowedCIDRs = []string{"10.0.0.0/8", SSHDisabled}
+			},
+			[]string{driverconst.APIServerCIDRs, driverconst.SSHCIDRs},
+		},
+		{
+			"allow-lists without quick create VCN",
+			func(v *Variables) {
+				v.APIServerAllowedCIDRs = []string{"203.0.113.0/24"}
+				v.SSHAllowedCIDRs = []string{SSHDisabled}
+			},
+			[]string{driverconst.APIServerCIDRs, driverconst.SSHCIDRs},
+		},
+		{
+			"network security groups with quick create VCN",
+			func(v *Variables) {
+				v.QuickCreateVCN = true
+				v.VCNCIDR = "10.0.0.0/16"
+				v.ControlPlaneNSG = "ocid1.networksecuritygroup.cp"
+				v.WorkerNodeNSG = "ocid1.networksecuritygroup.worker"
+			},
+			[]string{driverconst.ControlPlaneNSG, driverconst.WorkerNodeNSG},
+		},
+		{
+			"invalid quick create subnets",
+			func(v *Variables) {
+				v.QuickCreateVCN = true
+				v.VCNCIDR = "10.0.0.0/16"
+				v.ControlPlaneSubnetPrefixLength = 31
+				v.WorkerSubnetPrefixLength = 8
+			},
+			[]string{driverconst.ControlPlaneSubnetPrefixLength, driverconst.WorkerSubnetPrefixLength},
+		},
+		{
+			"quick create subnets do not fit",
+			func(v *Variables) {
+				v.QuickCreateVCN = true
+				v.VCNCIDR = "10.0.0.0/24"
+				v.LoadBalancerSubnetPrefixLength = 25
+				v.WorkerSubnetPrefixLength = 25
+			},
+			[]string{driverconst.VcnCIDR},
+		},
+		{
+			"quick create VCN uses the invalid cluster CIDR",
+			func(v *Variables) {
+				v.QuickCreateVCN = true
+			},
+			[]string{driverconst.VcnCIDR},
+		},
+		{
+			"invalid machine health checks",
+			func(v *Variables) {
+				v.MachineHealthCheckMaxUnhealthy = "many"
+				v.MachineHealthCheckNodeStartupTimeout = "20"
+				v.MachineHealthCheckUnhealthyTimeout = "5 minutes"
+				v.RawNodePools = []string{
+					`{"name":"np-1","shape":"VM.Standard.E4.Flex","machineHealthCheck":{"maxUnhealthy":"50%","unhealthyConditions":[{"type":"Ready","status":"Maybe","timeout":"5m"}]}}`,
+				}
+			},
+			[]string{
+				driverconst.RawNodePools,
+				driverconst.MachineHealthCheckMaxUnhealthy,
+				driverconst.MachineHealthCheckNodeStartupTimeout,
+				driverconst.MachineHealthCheckUnhealthyTimeout,
+			},
+		},
+		{
+			"invalid rollout settings",
+			func(v *Variables) {
+				v.ControlPlaneReplicas = 1
+				v.ControlPlaneMaxSurge = "0"
+				v.ControlPlaneRolloutAfter = "tomorrow"
+				v.ControlPlaneRolloutBeforeCertificatesExpiryDays = 1
+				v.NodePoolMaxSurge = "0"
+				v.NodePoolMaxUnavailable = "0%"
+				v.MinReadySeconds = -1
+				v.NodeDrainTimeout = "forever"
+				v.RawNodePools = []string{
+					`{"name":"np-1","shape":"VM.Standard.E4.Flex","rolloutStrategy":{"maxSurge":"lots","maxUnavailable":1},"nodeDrainTimeout":"1h"}`,
+				}
+			},
+			[]string{
+				driverconst.RawNodePools,
+				driverconst.ControlPlaneMaxSurge,
+				driverconst.ControlPlaneRolloutAfter,
+				driverconst.ControlPlaneRolloutBeforeCertificatesExpiryDays,
+				driverconst.NodePoolMaxSurge,
+				driverconst.MinReadySeconds,
+				driverconst.NodeDrainTimeout,
+			},
+		},
+		{
+			"invalid service account settings",
+			func(v *Variables) {
+				v.ServiceAccountNamespace = "Rancher_System"
+				v.ServiceAccountClusterRole = "roles/admin"
+			},
+			[]string{driverconst.ServiceAccountNamespace, driverconst.ServiceAccountClusterRole},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validVariables()
+			tt.modify(v)
+			err := v.Validate()
+			if tt.keys == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			verr, ok := err.(*ValidationError)
+			assert.True(t, ok)
+			var keys []string
+			for _, e := range verr.Errors {
+				keys = append(keys, e.Key)
+			}
+			assert.Equal(t, tt.keys, keys)
+		})
+	}
+}
+
+func TestValidationErrorMessage(t *testing.T) {
+	v := validVariables()
+	v.ControlPlaneReplicas = 2
+	v.PodCIDR = "bad"
+	err := v.Validate()
+	assert.EqualError(t, err, "invalid cluster options: pod-cidr: bad is not a valid CIDR; num-control-plane-nodes: 2 control plane nodes cannot maintain etcd quorum, use an odd number of nodes")
+}
+
+func TestValidateOptionsBeforeOCILookups(t *testing.T) {
+	getter := OCIClientGetter
+	defer func() {
+		OCIClientGetter = getter
+	}()
+	OCIClientGetter = func(v *Variables) (oci.Client, error) {
+		t.Fatal("options must be validated without OCI lookups")
+		return nil, nil
+	}
+
+	v := NewFromOptions(&types.DriverOptions{
+		StringOptions: map[string]string{
+			driverconst.PodCIDR:     "192.168.0.0",
+			driverconst.ClusterCIDR: "10.96.0.0/12",
+		},
+		IntOptions: map[string]int64{
+			driverconst.NumControlPlaneNodes: 2,
+		},
+		StringSliceOptions: map[string]*types.StringSlice{
+			driverconst.RawNodePools: {Value: []string{`{"name": "np-1"`}},
+		},
+	})
+	err := v.Validate()
+	assert.Error(t, err)
+	var keys []string
+	for _, optionErr := range err.(*ValidationError).Errors {
+		keys = append(keys, optionErr.Key)
+	}
+	assert.Equal(t, []string{driverconst.PodCIDR, driverconst.NumControlPlaneNodes, driverconst.RawNodePools}, keys)
+}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/common/auth"
 	"github.com/rancher/kontainer-engine/drivers/options"
 	"github.com/rancher/kontainer-engine/store"
 	"github.com/rancher/kontainer-engine/types"
@@ -21,6 +22,7 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"sort"
 	"strings"
 )
 
@@ -32,8 +34,19 @@ const (
 	DefaultVMShape                 = "VM.Standard.E4.Flex"
 	ProviderId                     = `oci://{{ ds["id"] }}`
 
-	DefaultCNEPath            = "olcne"
-	DefaultVerrazzanoResource = `apiVersion: install.verrazzano.io/v1beta1
+	// OCI authentication modes
+	AuthModeUserPrincipal     = "UserPrincipal"
+	AuthModeInstancePrincipal = "InstancePrincipal"
+	AuthModeWorkloadIdentity  = "WorkloadIdentity"
+
+	// CAPOCI OCIClusterIdentity principal types
+	identityTypeUserPrincipal     = "UserPrincipal"
+	identityTypeInstancePrincipal = "InstancePrincipal"
+	identityTypeWorkload          = "Workload"
+
+	DefaultCNEPath               = "olcne"
+	DefaultETCDBackupHelperImage = "container-registry.oracle.com/os/oraclelinux:8-slim"
+	DefaultVerrazzanoResource    = `apiVersion: install.verrazzano.io/v1beta1
 kind: Verrazzano
 metadata:
   name: managed
@@ -67,32 +80,124 @@ type NodePool struct {
 	Ocpus      int64  `json:"ocpus"`
 	VolumeSize int64  `json:"volumeSize"`
 	Shape      string `json:"shape"`
+	Scalable   bool   `json:"scalable,omitempty"`
+	// MinReplicas and MaxReplicas enable the cluster autoscaler for the node pool
+	MinReplicas int64 `json:"minReplicas,omitempty"`
+	MaxReplicas int64 `json:"maxReplicas,omitempty"`
+
+	// Optional overrides of the cluster defaults
+	ImageDisplayName    string `json:"imageDisplayName,omitempty"`
+	ImageId             string `json:"imageId,omitempty"`
+	SSHPublicKey        string `json:"sshPublicKey,omitempty"`
+	SubnetId            string `json:"subnetId,omitempty"`
+	FaultDomain         string `json:"faultDomain,omitempty"`
+	BootVolumeVpusPerGB int64  `json:"bootVolumeVpusPerGB,omitempty"`
+	// ActualImage is the image OCID override, looked up by display name
+	ActualImage string `json:"actualImage,omitempty"`
+	// Kubernetes node settings
+	Labels           map[string]string `json:"labels,omitempty"`
+	Taints           []Taint           `json:"taints,omitempty"`
+	KubeletExtraArgs map[string]string `json:"kubeletExtraArgs,omitempty"`
+	// MachineHealthCheck enables remediation of unhealthy nodes in the node pool
+	MachineHealthCheck *MachineHealthCheck `json:"machineHealthCheck,omitempty"`
+	// Optional overrides of the cluster rollout settings
+	RolloutStrategy  *RolloutStrategy `json:"rolloutStrategy,omitempty"`
+	MinReadySeconds  *int64           `json:"minReadySeconds,omitempty"`
+	NodeDrainTimeout string           `json:"nodeDrainTimeout,omitempty"`
+
+	// Hash of the node pool template, used to roll the node pool when its template changes
+	Hash string `json:"hash,omitempty"`
+}
+
+type Taint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Effect string `json:"effect"`
+}
+
+// KubeletArgs are the kubelet arguments for nodes in the node pool, including node labels
+func (np NodePool) KubeletArgs() map[string]string {
+	args := map[string]string{}
+	for k, v := range np.KubeletExtraArgs {
+		args[k] = v
+	}
+	if len(np.Labels) > 0 {
+		var labels []string
+		if existing := args["node-labels"]; existing != "" {
+			labels = append(labels, existing)
+		}
+		var keys []string
+		for k := range np.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			labels = append(labels, fmt.Sprintf("%s=%s", k, np.Labels[k]))
+		}
+		args["node-labels"] = strings.Join(labels, ",")
+	}
+	// required for OCI nodes, and not user configurable
+	args["cloud-provider"] = "external"
+	args["provider-id"] = ProviderId
+	return args
+}
+
+// IsAutoscaled is true if the node pool replicas are managed by the cluster autoscaler
+func (np NodePool) IsAutoscaled() bool {
+	return np.MaxReplicas > 0
 }
 
 var OCIClientGetter = func(v *Variables) (oci.Client, error) {
-	return oci.NewClient(v.GetConfigurationProvider())
+	provider, err := v.GetConfigurationProvider()
+	if err != nil {
+		return nil, err
+	}
+	return oci.NewClient(provider)
 }
 
 type (
 	//Variables are parameters for cluster lifecycle operations
 	Variables struct {
+		// SchemaVersion is the version of the persisted driver state
+		SchemaVersion int
+
 		Name             string
 		DisplayName      string
 		Namespace        string
 		Hash             string
 		ControlPlaneHash string
-		NodePoolHash     string
 
 		QuickCreateVCN     bool
 		VCNID              string
 		WorkerNodeSubnet   string
 		ControlPlaneSubnet string
 		LoadBalancerSubnet string
-		// Parsed subnets
-		Subnets       []Subnet `json:"subnets,omitempty"`
-		PodCIDR       string
-		ClusterCIDR   string
-		ProxyEndpoint string
+		// ControlPlaneEndpointSubnet is the subnet of the API load balancer, the control plane subnet if unset
+		ControlPlaneEndpointSubnet string
+		// Existing network security groups of an existing VCN, by subnet role
+		ControlPlaneNSG         string
+		ControlPlaneEndpointNSG string
+		WorkerNodeNSG           string
+		// Parsed subnets and network security groups
+		Subnets               []Subnet               `json:"subnets,omitempty"`
+		NetworkSecurityGroups []NetworkSecurityGroup `json:"networkSecurityGroups,omitempty"`
+		// Parsed CIDRs of an existing VCN, only looked up when a proxy is used
+		ExistingVCNCIDRs []string `json:"existingVcnCidrs,omitempty"`
+		PodCIDR          string
+		ClusterCIDR      string
+		// Private clusters have no public subnets, and only accept API and SSH traffic from the VCN or the allowed CIDRs
+		PrivateCluster bool
+		AllowedCIDRs   []string
+		// Allow-lists of the Quick Create API endpoint and SSH ingress rules, SSH may be none
+		APIServerAllowedCIDRs []string
+		SSHAllowedCIDRs       []string
+		// Quick Create VCN layout, the subnet prefix lengths are optional
+		VCNCIDR                                string
+		ControlPlaneSubnetPrefixLength         int64
+		ControlPlaneEndpointSubnetPrefixLength int64
+		LoadBalancerSubnetPrefixLength         int64
+		WorkerSubnetPrefixLength               int64
+		ProxyEndpoint                          string
 
 		// Cluster topology and configuration
 		KubernetesVersion       string
@@ -107,7 +212,21 @@ type (
 		RawNodePools            []string
 		ApplyYAMLS              []string
 		// Parsed node pools
-		NodePools []NodePool
+		NodePools             []NodePool
+		NodePoolScalingPolicy string
+		// Machine health checks, the settings are the defaults for node pool health checks
+		ControlPlaneMachineHealthCheck       bool
+		MachineHealthCheckMaxUnhealthy       string
+		MachineHealthCheckNodeStartupTimeout string
+		MachineHealthCheckUnhealthyTimeout   string
+		// Rollout settings, the node pool settings are the defaults for node pools
+		ControlPlaneMaxSurge                            string
+		ControlPlaneRolloutAfter                        string
+		ControlPlaneRolloutBeforeCertificatesExpiryDays int64
+		NodePoolMaxSurge                                string
+		NodePoolMaxUnavailable                          string
+		MinReadySeconds                                 int64
+		NodeDrainTimeout                                string
 
 		// ImageID is looked up by display name
 		ImageDisplayName string
@@ -127,33 +246,63 @@ type (
 		VerrazzanoTag       string
 		InstallCalico       bool
 		InstallCCM          bool
-		CNEPath             string
-		TigeraTag           string
-		ETCDImageTag        string
-		CoreDNSImageTag     string
+		// InstallClusterAutoscaler installs the cluster autoscaler for node pools with min and max replicas
+		InstallClusterAutoscaler bool
+		CNEPath                  string
+		TigeraTag                string
+		ETCDImageTag             string
+		CoreDNSImageTag          string
+		// AllowCustomImageTags skips checking image tags against the OCNE version mapping during upgrades
+		AllowCustomImageTags bool
 
 		// Private registry
 		PrivateRegistry string
 
+		// Rancher service account token
+		ServiceAccountTokenExpirationHours int64
+		ServiceAccountTokenRotationHours   int64
+		ServiceAccountNamespace            string
+		ServiceAccountClusterRole          string
+		// AppliedServiceAccountNamespace and AppliedServiceAccountClusterRole are the service account settings last applied to the managed cluster
+		AppliedServiceAccountNamespace   string
+		AppliedServiceAccountClusterRole string
+
+		// ETCD snapshots
+		ETCDBackupS3Endpoint   string
+		ETCDBackupS3Region     string
+		ETCDBackupS3Bucket     string
+		ETCDBackupS3Folder     string
+		ETCDBackupCredentialId string
+		ETCDBackupHelperImage  string
+
 		// OCI Credentials
-		CAPIOCINamespace     string
-		CAPICredentialName   string
-		CloudCredentialId    string
-		CompartmentID        string
-		Fingerprint          string
-		PrivateKey           string
-		PrivateKeyPassphrase string
-		Region               string
-		Tenancy              string
-		User                 string
+		// AuthMode is how the driver, CAPI, and the managed cluster authenticate with OCI
+		AuthMode           string
+		CAPIOCINamespace   string
+		CAPICredentialName string
+		CloudCredentialId  string
+		CompartmentID      string
+		Region             string
+		// AppliedFingerprint is the API key fingerprint of the credentials last pushed to the CAPI, CCM, and CSI secrets
+		AppliedFingerprint string
+		// Credentials are loaded from the cloud credential, and are never persisted in the driver state
+		Fingerprint          string `json:"-"`
+		PrivateKey           string `json:"-"`
+		PrivateKeyPassphrase string `json:"-"`
+		Tenancy              string `json:"-"`
+		User                 string `json:"-"`
 
 		// Supplied for templating
 		ProviderId string
+
+		// ExistingControlPlaneReplicas is the control plane size loaded from the driver state of an existing cluster
+		ExistingControlPlaneReplicas int64 `json:"-"`
 	}
 )
 
-// NewFromOptions creates a new Variables given *types.DriverOptions
-func NewFromOptions(ctx context.Context, driverOptions *types.DriverOptions) (*Variables, error) {
+// NewFromOptions creates a new Variables given *types.DriverOptions.
+// Only the options are parsed, so they can be validated before SetDynamicValues looks up OCI resources.
+func NewFromOptions(driverOptions *types.DriverOptions) *Variables {
 	v := &Variables{
 		Name:              options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ClusterName).(string),
 		DisplayName:       options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.DisplayName, "displayName").(string),
@@ -163,17 +312,31 @@ func NewFromOptions(ctx context.Context, driverOptions *types.DriverOptions) (*V
 		// User and authentication
 		SSHPublicKey:      options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.NodePublicKeyContents, "nodePublicKeyContents").(string),
 		CloudCredentialId: options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.CloudCredentialId, "cloudCredentialId").(string),
+		AuthMode:          options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.AuthMode, "authMode").(string),
 		Region:            options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.Region, "region").(string),
 		CompartmentID:     options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.CompartmentID, "compartmentId").(string),
 
 		// Networking
-		QuickCreateVCN:     options.GetValueFromDriverOptions(driverOptions, types.BoolType, driverconst.QuickCreateVCN, "quickCreateVcn").(bool),
-		VCNID:              options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.VcnID, "vcnId").(string),
-		WorkerNodeSubnet:   options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.WorkerNodeSubnet, "workerNodeSubnet").(string),
-		LoadBalancerSubnet: options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.LoadBalancerSubnet, "loadBalancerSubnet").(string),
-		ControlPlaneSubnet: options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ControlPlaneSubnet, "controlPlaneSubnet").(string),
-		PodCIDR:            options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.PodCIDR, "podCidr").(string),
-		ClusterCIDR:        options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ClusterCIDR, "clusterCidr").(string),
+		QuickCreateVCN:                         options.GetValueFromDriverOptions(driverOptions, types.BoolType, driverconst.QuickCreateVCN, "quickCreateVcn").(bool),
+		VCNID:                                  options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.VcnID, "vcnId").(string),
+		WorkerNodeSubnet:                       options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.WorkerNodeSubnet, "workerNodeSubnet").(string),
+		LoadBalancerSubnet:                     options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.LoadBalancerSubnet, "loadBalancerSubnet").(string),
+		ControlPlaneSubnet:                     options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ControlPlaneSubnet, "controlPlaneSubnet").(string),
+		ControlPlaneEndpointSubnet:             options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ControlPlaneEndpointSubnet, "controlPlaneEndpointSubnet").(string),
+		ControlPlaneNSG:                        options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ControlPlaneNSG, "controlPlaneNsg").(string),
+		ControlPlaneEndpointNSG:                options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ControlPlaneEndpointNSG, "controlPlaneEndpointNsg").(string),
+		WorkerNodeNSG:                          options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.WorkerNodeNSG, "workerNodeNsg").(string),
+		PodCIDR:                                options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.PodCIDR, "podCidr").(string),
+		ClusterCIDR:                            options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ClusterCIDR, "clusterCidr").(string),
+		PrivateCluster:                         options.GetValueFromDriverOptions(driverOptions, types.BoolType, driverconst.PrivateCluster, "privateCluster").(bool),
+		AllowedCIDRs:                           options.GetValueFromDriverOptions(driverOptions, types.StringSliceType, driverconst.AllowedCIDRs, "allowedCidrs").(*types.StringSlice).Value,
+		APIServerAllowedCIDRs:                  options.GetValueFromDriverOptions(driverOptions, types.StringSliceType, driverconst.APIServerCIDRs, "apiServerAllowedCidrs").(*types.StringSlice).Value,
+		SSHAllowedCIDRs:                        options.GetValueFromDriverOptions(driverOptions, types.StringSliceType, driverconst.SSHCIDRs, "sshAllowedCidrs").(*types.StringSlice).Value,
+		VCNCIDR:                                options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.VcnCIDR, "vcnCidr").(string),
+		ControlPlaneSubnetPrefixLength:         options.GetValueFromDriverOptions(driverOptions, types.IntType, driverconst.ControlPlaneSubnetPrefixLength, "controlPlaneSubnetPrefixLength").(int64),
+		ControlPlaneEndpointSubnetPrefixLength: options.GetValueFromDriverOptions(driverOptions, types.IntType, driverconst.ControlPlaneEndpointSubnetPrefixLength, "controlPlaneEndpointSubnetPrefixLength").(int64),
+		LoadBalancerSubnetPrefixLength:         options.GetValueFromDriverOptions(driverOptions, types.IntType, driverconst.LoadBalancerSubnetPrefixLength, "loadBalancerSubnetPrefixLength").(int64),
+		WorkerSubnetPrefixLength:               options.GetValueFromDriverOptions(driverOptions, types.IntType, driverconst.WorkerSubnetPrefixLength, "workerSubnetPrefixLength").(int64),
 
 		// VM settings
 		ImageDisplayName:        options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ImageDisplayName, "imageDisplayName").(string),
@@ -185,18 +348,49 @@ func NewFromOptions(ctx context.Context, driverOptions *types.DriverOptions) (*V
 		ControlPlaneVolumeGbs:   options.GetValueFromDriverOptions(driverOptions, types.IntType, driverconst.ControlPlaneVolumeGbs, "controlPlaneVolumeGbs").(int64),
 		RawNodePools:            options.GetValueFromDriverOptions(driverOptions, types.StringSliceType, driverconst.RawNodePools, "nodePools").(*types.StringSlice).Value,
 		ApplyYAMLS:              options.GetValueFromDriverOptions(driverOptions, types.StringSliceType, driverconst.ApplyYAMLs, "applyYamls").(*types.StringSlice).Value,
+		NodePoolScalingPolicy:   options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.NodePoolScalingPolicy, "nodePoolScalingPolicy").(string),
+
+		// Machine health checks
+		ControlPlaneMachineHealthCheck:                  options.GetValueFromDriverOptions(driverOptions, types.BoolType, driverconst.ControlPlaneMachineHealthCheck, "controlPlaneMachineHealthCheck").(bool),
+		MachineHealthCheckMaxUnhealthy:                  options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.MachineHealthCheckMaxUnhealthy, "machineHealthCheckMaxUnhealthy").(string),
+		MachineHealthCheckNodeStartupTimeout:            options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.MachineHealthCheckNodeStartupTimeout, "machineHealthCheckNodeStartupTimeout").(string),
+		MachineHealthCheckUnhealthyTimeout:              options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.MachineHealthCheckUnhealthyTimeout, "machineHealthCheckUnhealthyTimeout").(string),
+		ControlPlaneMaxSurge:                            options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ControlPlaneMaxSurge, "controlPlaneMaxSurge").(string),
+		ControlPlaneRolloutAfter:                        options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ControlPlaneRolloutAfter, "controlPlaneRolloutAfter").(string),
+		ControlPlaneRolloutBeforeCertificatesExpiryDays: options.GetValueFromDriverOptions(driverOptions, types.IntType, driverconst.ControlPlaneRolloutBeforeCertificatesExpiryDays, "controlPlaneRolloutBeforeCertificatesExpiryDays").(int64),
+		NodePoolMaxSurge:                                options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.NodePoolMaxSurge, "nodePoolMaxSurge").(string),
+		NodePoolMaxUnavailable:                          options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.NodePoolMaxUnavailable, "nodePoolMaxUnavailable").(string),
+		MinReadySeconds:                                 options.GetValueFromDriverOptions(driverOptions, types.IntType, driverconst.MinReadySeconds, "minReadySeconds").(int64),
+		NodeDrainTimeout:                                options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.NodeDrainTimeout, "nodeDrainTimeout").(string),
 
 		// Image settings
-		CNEPath:         options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.CNEPath, "cnePath").(string),
-		TigeraTag:       options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.TigeraTag, "tigeraImageTag").(string),
-		ETCDImageTag:    options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ETCDTag, "etcdImageTag").(string),
-		CoreDNSImageTag: options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.CoreDNSTag, "corednsImageTag").(string),
-		InstallCalico:   options.GetValueFromDriverOptions(driverOptions, types.BoolType, driverconst.InstallCalico, "installCalico").(bool),
-		InstallCCM:      options.GetValueFromDriverOptions(driverOptions, types.BoolType, driverconst.InstallCCM, "installCcm").(bool),
+		CNEPath:              options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.CNEPath, "cnePath").(string),
+		TigeraTag:            options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.TigeraTag, "tigeraImageTag").(string),
+		ETCDImageTag:         options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ETCDTag, "etcdImageTag").(string),
+		CoreDNSImageTag:      options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.CoreDNSTag, "corednsImageTag").(string),
+		AllowCustomImageTags: options.GetValueFromDriverOptions(driverOptions, types.BoolType, driverconst.AllowCustomImageTags, "allowCustomImageTags").(bool),
+		InstallCalico:        options.GetValueFromDriverOptions(driverOptions, types.BoolType, driverconst.InstallCalico, "installCalico").(bool),
+		InstallCCM:           options.GetValueFromDriverOptions(driverOptions, types.BoolType, driverconst.InstallCCM, "installCcm").(bool),
+
+		InstallClusterAutoscaler: options.GetValueFromDriverOptions(driverOptions, types.BoolType, driverconst.InstallClusterAutoscaler, "installClusterAutoscaler").(bool),
 
 		// Private Registry
 		PrivateRegistry: options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.PrivateRegistry, "privateRegistry").(string),
 
+		// Rancher service account token
+		ServiceAccountTokenExpirationHours: options.GetValueFromDriverOptions(driverOptions, types.IntType, driverconst.ServiceAccountTokenExpirationHours, "serviceAccountTokenExpirationHours").(int64),
+		ServiceAccountTokenRotationHours:   options.GetValueFromDriverOptions(driverOptions, types.IntType, driverconst.ServiceAccountTokenRotationHours, "serviceAccountTokenRotationHours").(int64),
+		ServiceAccountNamespace:            options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ServiceAccountNamespace, "serviceAccountNamespace").(string),
+		ServiceAccountClusterRole:          options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ServiceAccountClusterRole, "serviceAccountClusterRole").(string),
+
+		// ETCD snapshots
+		ETCDBackupS3Endpoint:   options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ETCDBackupS3Endpoint, "etcdBackupS3Endpoint").(string),
+		ETCDBackupS3Region:     options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ETCDBackupS3Region, "etcdBackupS3Region").(string),
+		ETCDBackupS3Bucket:     options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ETCDBackupS3Bucket, "etcdBackupS3Bucket").(string),
+		ETCDBackupS3Folder:     options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ETCDBackupS3Folder, "etcdBackupS3Folder").(string),
+		ETCDBackupCredentialId: options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ETCDBackupCredentialId, "etcdBackupCredentialId").(string),
+		ETCDBackupHelperImage:  options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.ETCDBackupHelperImage, "etcdBackupHelperImage").(string),
+
 		// Verrazzano settings
 		VerrazzanoTag:      options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.VerrazzanoTag, "verrazzanoTag").(string),
 		VerrazzanoVersion:  options.GetValueFromDriverOptions(driverOptions, types.StringType, driverconst.VerrazzanoVersion, "verrazzanoVersion").(string),
@@ -213,27 +407,38 @@ func NewFromOptions(ctx context.Context, driverOptions *types.DriverOptions) (*V
 		CAPIOCINamespace: CAPIOCINamespace,
 	}
 	v.Namespace = v.Name
-
-	if err := v.SetDynamicValues(ctx); err != nil {
-		return v, err
-	}
-	return v, nil
+	return v
 }
 
-// SetUpdateValues are the values potentially changed during an update operation
+// SetUpdateValues are the values potentially changed during an update operation. OCI resources are looked up later by SetDynamicValues.
 func (v *Variables) SetUpdateValues(ctx context.Context, vNew *Variables) error {
 	// Uninstall Verrazzano if the new state has no Verrazzano
 	v.UninstallVerrazzano = false
 	if v.InstallVerrazzano && !vNew.InstallVerrazzano {
 		v.UninstallVerrazzano = true
 	}
-	v.KubernetesVersion = vNew.KubernetesVersion
 	v.ControlPlaneReplicas = vNew.ControlPlaneReplicas
 	v.ImageDisplayName = vNew.ImageDisplayName
 	v.ControlPlaneOCPUs = vNew.ControlPlaneOCPUs
 	v.ControlPlaneMemoryGbs = vNew.ControlPlaneMemoryGbs
 	v.ControlPlaneVolumeGbs = vNew.ControlPlaneVolumeGbs
 	v.RawNodePools = vNew.RawNodePools
+	v.NodePoolScalingPolicy = vNew.NodePoolScalingPolicy
+	v.ControlPlaneMachineHealthCheck = vNew.ControlPlaneMachineHealthCheck
+	v.MachineHealthCheckMaxUnhealthy = vNew.MachineHealthCheckMaxUnhealthy
+	v.MachineHealthCheckNodeStartupTimeout = vNew.MachineHealthCheckNodeStartupTimeout
+	v.MachineHealthCheckUnhealthyTimeout = vNew.MachineHealthCheckUnhealthyTimeout
+	v.AllowedCIDRs = vNew.AllowedCIDRs
+	v.APIServerAllowedCIDRs = vNew.APIServerAllowedCIDRs
+	v.SSHAllowedCIDRs = vNew.SSHAllowedCIDRs
+	v.ControlPlaneMaxSurge = vNew.ControlPlaneMaxSurge
+	v.ControlPlaneRolloutAfter = vNew.ControlPlaneRolloutAfter
+	v.ControlPlaneRolloutBeforeCertificatesExpiryDays = vNew.ControlPlaneRolloutBeforeCertificatesExpiryDays
+	v.NodePoolMaxSurge = vNew.NodePoolMaxSurge
+	v.NodePoolMaxUnavailable = vNew.NodePoolMaxUnavailable
+	v.MinReadySeconds = vNew.MinReadySeconds
+	v.NodeDrainTimeout = vNew.NodeDrainTimeout
+	v.InstallClusterAutoscaler = vNew.InstallClusterAutoscaler
 	v.SSHPublicKey = vNew.SSHPublicKey
 	v.DisplayName = vNew.DisplayName
 	v.SkipOCNEInstall = vNew.SkipOCNEInstall
@@ -242,12 +447,30 @@ func (v *Variables) SetUpdateValues(ctx context.Context, vNew *Variables) error
 	v.TigeraTag = vNew.TigeraTag
 	v.ETCDImageTag = vNew.ETCDImageTag
 	v.CoreDNSImageTag = vNew.CoreDNSImageTag
+	v.AllowCustomImageTags = vNew.AllowCustomImageTags
 	v.PrivateRegistry = vNew.PrivateRegistry
 	v.InstallVerrazzano = vNew.InstallVerrazzano
 	v.VerrazzanoTag = vNew.VerrazzanoTag
 	v.VerrazzanoVersion = vNew.VerrazzanoVersion
 	v.VerrazzanoResource = vNew.VerrazzanoResource
-	return v.SetDynamicValues(ctx)
+	v.ServiceAccountTokenExpirationHours = vNew.ServiceAccountTokenExpirationHours
+	v.ServiceAccountTokenRotationHours = vNew.ServiceAccountTokenRotationHours
+	v.ServiceAccountNamespace = vNew.ServiceAccountNamespace
+	v.ServiceAccountClusterRole = vNew.ServiceAccountClusterRole
+	v.ETCDBackupS3Endpoint = vNew.ETCDBackupS3Endpoint
+	v.ETCDBackupS3Region = vNew.ETCDBackupS3Region
+	v.ETCDBackupS3Bucket = vNew.ETCDBackupS3Bucket
+	v.ETCDBackupS3Folder = vNew.ETCDBackupS3Folder
+	v.ETCDBackupCredentialId = vNew.ETCDBackupCredentialId
+	v.ETCDBackupHelperImage = vNew.ETCDBackupHelperImage
+	v.OCNEVersion = vNew.OCNEVersion
+
+	// set the Kubernetes version after the image tags, so an upgrade moves the tags to the new version
+	ki, err := k8s.InjectedInterface()
+	if err != nil {
+		return err
+	}
+	return v.SetKubernetesVersion(ctx, ki, vNew.KubernetesVersion)
 }
 
 // SetDynamicValues sets dynamic values
@@ -280,6 +503,18 @@ func (v *Variables) SetDynamicValues(ctx context.Context) error {
 	if err := v.setSubnets(ctx, ociClient); err != nil {
 		return err
 	}
+	// get existing VCN metadata from OCI
+	if err := v.setExistingVCNCIDRs(ctx, ociClient); err != nil {
+		return err
+	}
+	// get network security group metadata from OCI
+	if err := v.setNetworkSecurityGroups(ctx, ociClient); err != nil {
+		return err
+	}
+	// get node pool image and subnet overrides from OCI
+	if err := v.setNodePoolOverrides(ctx, ociClient); err != nil {
+		return err
+	}
 
 	// set hashes for controlplane updates
 	v.SetHashes()
@@ -287,13 +522,36 @@ func (v *Variables) SetDynamicValues(ctx context.Context) error {
 }
 
 // GetConfigurationProvider creates a new configuration provider from Variables
-func (v *Variables) GetConfigurationProvider() common.ConfigurationProvider {
+func (v *Variables) GetConfigurationProvider() (common.ConfigurationProvider, error) {
+	switch v.AuthMode {
+	case AuthModeInstancePrincipal:
+		return auth.InstancePrincipalConfigurationProvider()
+	case AuthModeWorkloadIdentity:
+		return auth.OkeWorkloadIdentityConfigurationProvider()
+	}
 	var passphrase *string
 	if len(v.PrivateKeyPassphrase) > 0 {
 		passphrase = &v.PrivateKeyPassphrase
 	}
 	privateKey := strings.TrimSpace(v.PrivateKey)
-	return common.NewRawConfigurationProvider(v.Tenancy, v.User, v.Region, v.Fingerprint, privateKey, passphrase)
+	return common.NewRawConfigurationProvider(v.Tenancy, v.User, v.Region, v.Fingerprint, privateKey, passphrase), nil
+}
+
+// UsesUserPrincipal is true if OCI API keys from the cloud credential are used for authentication
+func (v Variables) UsesUserPrincipal() bool {
+	return v.AuthMode == "" || v.AuthMode == AuthModeUserPrincipal
+}
+
+// IdentityType is the CAPI OCIClusterIdentity type for the authentication mode
+func (v Variables) IdentityType() string {
+	switch v.AuthMode {
+	case AuthModeInstancePrincipal:
+		return identityTypeInstancePrincipal
+	case AuthModeWorkloadIdentity:
+		return identityTypeWorkload
+	default:
+		return identityTypeUserPrincipal
+	}
 }
 
 // GetCAPIClusterKubeConfig fetches the cluster's kubeconfig
@@ -375,6 +633,39 @@ func (v *Variables) setImageId(ctx context.Context, client oci.Client) error {
 	return nil
 }
 
+func (v *Variables) setNodePoolOverrides(ctx context.Context, client oci.Client) error {
+	for i := range v.NodePools {
+		np := &v.NodePools[i]
+		switch {
+		case np.ImageId != "":
+			np.ActualImage = np.ImageId
+		case np.ImageDisplayName != "":
+			imageId, err := client.GetImageIdByName(ctx, np.ImageDisplayName, v.CompartmentID)
+			if err != nil {
+				return fmt.Errorf("failed to get image for node pool %s: %v", np.Name, err)
+			}
+			np.ActualImage = imageId
+		default:
+			np.ActualImage = ""
+		}
+
+		if np.SubnetId != "" {
+			sn, err := client.GetSubnetById(ctx, np.SubnetId)
+			if err != nil {
+				return fmt.Errorf("failed to get subnet %s for node pool %s", np.SubnetId, np.Name)
+			}
+			// Quick Create VCNs may not exist yet
+			if v.VCNID != "" && sn.VcnId != nil && *sn.VcnId != v.VCNID {
+				return fmt.Errorf("subnet %s for node pool %s is not in VCN %s", np.SubnetId, np.Name, v.VCNID)
+			}
+			if v.PrivateCluster && oci.SubnetAccess(*sn) == subnetPublic {
+				return fmt.Errorf("subnet %s for node pool %s is public, private clusters only use private subnets", np.SubnetId, np.Name)
+			}
+		}
+	}
+	return nil
+}
+
 func (v *Variables) setSubnets(ctx context.Context, client oci.Client) error {
 	var subnets []Subnet
 	subnetCache := map[string]*Subnet{}
@@ -389,6 +680,9 @@ func (v *Variables) setSubnets(ctx context.Context, client oci.Client) error {
 			}
 		}
 		if subnet != nil {
+			if v.PrivateCluster && subnet.Type == subnetPublic {
+				return fmt.Errorf("%s subnet %s is public, private clusters only use private subnets", role, subnetId)
+			}
 			subnets = append(subnets, *subnet)
 		}
 		return nil
@@ -400,7 +694,7 @@ func (v *Variables) setSubnets(ctx context.Context, client oci.Client) error {
 	if err := addSubnetForRole(v.ControlPlaneSubnet, controlPlaneSubnetRole); err != nil {
 		return err
 	}
-	if err := addSubnetForRole(v.ControlPlaneSubnet, controlPlaneEndpointSubnetRole); err != nil {
+	if err := addSubnetForRole(valueOrDefault(v.ControlPlaneEndpointSubnet, v.ControlPlaneSubnet), controlPlaneEndpointSubnetRole); err != nil {
 		return err
 	}
 	if err := addSubnetForRole(v.WorkerNodeSubnet, workerSubnetRole); err != nil {
@@ -410,6 +704,59 @@ func (v *Variables) setSubnets(ctx context.Context, client oci.Client) error {
 	return nil
 }
 
+// setExistingVCNCIDRs looks up the CIDRs of an existing VCN, which bypass the proxy
+func (v *Variables) setExistingVCNCIDRs(ctx context.Context, client oci.Client) error {
+	if v.QuickCreateVCN || v.ProxyEndpoint == "" || v.VCNID == "" {
+		v.ExistingVCNCIDRs = nil
+		return nil
+	}
+	vcn, err := client.GetVCNById(ctx, v.VCNID)
+	if err != nil {
+		return fmt.Errorf("failed to get VCN %s: %v", v.VCNID, err)
+	}
+	v.ExistingVCNCIDRs = vcn.CidrBlocks
+	if len(v.ExistingVCNCIDRs) < 1 && vcn.CidrBlock != nil {
+		v.ExistingVCNCIDRs = []string{*vcn.CidrBlock}
+	}
+	return nil
+}
+
+// setNetworkSecurityGroups looks up the network security groups of an existing VCN, which must be in that VCN.
+// Service load balancers are created by the CCM, which does not use the cluster network security groups.
+func (v *Variables) setNetworkSecurityGroups(ctx context.Context, client oci.Client) error {
+	var nsgs []NetworkSecurityGroup
+	for _, roleNSG := range []struct {
+		id   string
+		role string
+	}{
+		{v.ControlPlaneNSG, controlPlaneSubnetRole},
+		{v.ControlPlaneEndpointNSG, controlPlaneEndpointSubnetRole},
+		{v.WorkerNodeNSG, workerSubnetRole},
+	} {
+		if roleNSG.id == "" {
+			continue
+		}
+		nsg, err := client.GetNetworkSecurityGroupById(ctx, roleNSG.id)
+		if err != nil {
+			return fmt.Errorf("failed to get %s network security group %s: %v", roleNSG.role, roleNSG.id, err)
+		}
+		if nsg.VcnId != nil && *nsg.VcnId != v.VCNID {
+			return fmt.Errorf("%s network security group %s is not in VCN %s", roleNSG.role, roleNSG.id, v.VCNID)
+		}
+		name := roleNSG.role
+		if nsg.DisplayName != nil {
+			name = *nsg.DisplayName
+		}
+		nsgs = append(nsgs, NetworkSecurityGroup{
+			Id:   roleNSG.id,
+			Name: name,
+			Role: roleNSG.role,
+		})
+	}
+	v.NetworkSecurityGroups = nsgs
+	return nil
+}
+
 func getSubnetById(ctx context.Context, client oci.Client, subnetId, role string) (*Subnet, error) {
 	sn, err := client.GetSubnetById(ctx, subnetId)
 	if err != nil {
@@ -427,6 +774,16 @@ func getSubnetById(ctx context.Context, client oci.Client, subnetId, role string
 
 // SetupOCIAuth dynamically loads OCI authentication
 func SetupOCIAuth(ctx context.Context, client kubernetes.Interface, v *Variables) error {
+	// instance principals and workload identity do not use API keys
+	if !v.UsesUserPrincipal() {
+		v.CAPICredentialName = ""
+		v.User = ""
+		v.Fingerprint = ""
+		v.Tenancy = ""
+		v.PrivateKeyPassphrase = ""
+		v.PrivateKey = ""
+		return nil
+	}
 	ccName, ccNamespace := v.cloudCredentialNameAndNamespace()
 	cc, err := client.CoreV1().Secrets(ccNamespace).Get(ctx, ccName, metav1.GetOptions{})
 	// Failed to retrieve cloud credentials
@@ -483,6 +840,8 @@ func (v *Variables) SetQuickCreateVCNInfo(ctx context.Context, di dynamic.Interf
 			switch subnetRole {
 			case "control-plane":
 				v.ControlPlaneSubnet = subnetId
+			case "control-plane-endpoint":
+				v.ControlPlaneEndpointSubnet = subnetId
 			case "service-lb":
 				v.LoadBalancerSubnet = subnetId
 			case "worker":
@@ -500,6 +859,16 @@ func (v *Variables) isNetworkingUnset() bool {
 	return len(v.VCNID) < 1 || len(v.ControlPlaneSubnet) < 1 || len(v.LoadBalancerSubnet) < 1 || len(v.WorkerNodeSubnet) < 1
 }
 
+// ETCDBackupCredentialNameAndNamespace returns the name and namespace of the etcd backup bucket credential secret
+func (v *Variables) ETCDBackupCredentialNameAndNamespace() (string, string) {
+	split := strings.Split(v.ETCDBackupCredentialId, ":")
+
+	if len(split) == 1 {
+		return split[0], "cattle-global-data"
+	}
+	return split[1], split[0]
+}
+
 func (v *Variables) cloudCredentialNameAndNamespace() (string, string) {
 	split := strings.Split(v.CloudCredentialId, ":")
 
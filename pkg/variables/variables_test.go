@@ -4,7 +4,13 @@
 package variables
 
 import (
+	"context"
+	"github.com/oracle/oci-go-sdk/v65/core"
 	"github.com/stretchr/testify/assert"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/oci/fake"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
 	"testing"
 )
 
@@ -75,3 +81,355 @@ func TestParseNodePools(t *testing.T) {
 	assert.Equal(t, np1.Name, "np-1")
 	assert.Equal(t, np2.Name, "np-2")
 }
+
+func TestSetNodePoolOverrides(t *testing.T) {
+	vcnId := "vcn"
+	otherVcnId := "other-vcn"
+	client := &fake.Client{
+		Images: map[string]string{
+			"gpu-image": "ocid1.image.gpu",
+		},
+		Subnets: map[string]*core.Subnet{
+			"subnet": {VcnId: &vcnId},
+			"other":  {VcnId: &otherVcnId},
+		},
+	}
+	var tests = []struct {
+		name     string
+		np       NodePool
+		image    string
+		hasError bool
+	}{
+		{
+			"no overrides",
+			NodePool{Name: "a"},
+			"",
+			false,
+		},
+		{
+			"image by display name",
+			NodePool{Name: "a", ImageDisplayName: "gpu-image"},
+			"ocid1.image.gpu",
+			false,
+		},
+		{
+			"image by id",
+			NodePool{Name: "a", ImageId: "ocid1.image.xyz", ImageDisplayName: "gpu-image"},
+			"ocid1.image.xyz",
+			false,
+		},
+		{
+			"unknown image",
+			NodePool{Name: "a", ImageDisplayName: "unknown"},
+			"",
+			true,
+		},
+		{
+			"subnet in VCN",
+			NodePool{Name: "a", SubnetId: "subnet"},
+			"",
+			false,
+		},
+		{
+			"subnet in other VCN",
+			NodePool{Name: "a", SubnetId: "other"},
+			"",
+			true,
+		},
+		{
+			"unknown subnet",
+			NodePool{Name: "a", SubnetId: "unknown"},
+			"",
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Variables{
+				VCNID:     vcnId,
+				NodePools: []NodePool{tt.np},
+			}
+			err := v.setNodePoolOverrides(context.TODO(), client)
+			if tt.hasError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.image, v.NodePools[0].ActualImage)
+		})
+	}
+}
+
+func TestSetSubnetsPrivateCluster(t *testing.T) {
+	public := func(cidr string) *core.Subnet {
+		allow := false
+		return &core.Subnet{CidrBlock: &cidr, ProhibitPublicIpOnVnic: &allow, ProhibitInternetIngress: &allow}
+	}
+	private := func(cidr string) *core.Subnet {
+		prohibit := true
+		return &core.Subnet{CidrBlock: &cidr, ProhibitPublicIpOnVnic: &prohibit, ProhibitInternetIngress: &prohibit}
+	}
+	client := &fake.Client{
+		Subnets: map[string]*core.Subnet{
+			"public-lb":  public("10.0.0.32/27"),
+			"private-lb": private("10.0.0.32/27"),
+			"cp":         private("10.0.0.0/29"),
+			"worker":     private("10.0.64.0/20"),
+		},
+	}
+	var tests = []struct {
+		name             string
+		private          bool
+		loadBalancer     string
+		loadBalancerType string
+		hasError         bool
+	}{
+		{"public cluster with public subnet", false, "public-lb", subnetPublic, false},
+		{"private cluster with private subnets", true, "private-lb", subnetPrivate, false},
+		{"private cluster with public subnet", true, "public-lb", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Variables{
+				PrivateCluster:     tt.private,
+				LoadBalancerSubnet: tt.loadBalancer,
+				ControlPlaneSubnet: "cp",
+				WorkerNodeSubnet:   "worker",
+			}
+			err := v.setSubnets(context.TODO(), client)
+			if tt.hasError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, v.Subnets, 4)
+			assert.Equal(t, loadBalancerSubnetRole, v.Subnets[0].Role)
+			assert.Equal(t, tt.loadBalancerType, v.Subnets[0].Type)
+		})
+	}
+
+	// node pool subnets must also be private
+	v := &Variables{
+		PrivateCluster: true,
+		NodePools:      []NodePool{{Name: "a", SubnetId: "public-lb"}},
+	}
+	assert.Error(t, v.setNodePoolOverrides(context.TODO(), client))
+}
+
+func TestSetSubnetsControlPlaneEndpoint(t *testing.T) {
+	subnet := func(cidr string, prohibitPublicIp bool) *core.Subnet {
+		return &core.Subnet{CidrBlock: &cidr, ProhibitPublicIpOnVnic: &prohibitPublicIp, ProhibitInternetIngress: &prohibitPublicIp}
+	}
+	client := &fake.Client{
+		Subnets: map[string]*core.Subnet{
+			"endpoint": subnet("10.0.0.8/29", false),
+			"cp":       subnet("10.0.0.0/29", true),
+			"lb":       subnet("10.0.0.32/27", true),
+			"worker":   subnet("10.0.64.0/20", true),
+		},
+	}
+	var tests = []struct {
+		name         string
+		endpoint     string
+		private      bool
+		endpointId   string
+		endpointType string
+		hasError     bool
+	}{
+		{"control plane subnet by default", "", false, "cp", subnetPrivate, false},
+		{"public endpoint with private nodes", "endpoint", false, "endpoint", subnetPublic, false},
+		{"public endpoint in a private cluster", "endpoint", true, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Variables{
+				PrivateCluster:             tt.private,
+				LoadBalancerSubnet:         "lb",
+				ControlPlaneSubnet:         "cp",
+				ControlPlaneEndpointSubnet: tt.endpoint,
+				WorkerNodeSubnet:           "worker",
+			}
+			err := v.setSubnets(context.TODO(), client)
+			if tt.hasError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, v.Subnets, 4)
+			assert.Equal(t, "cp", v.Subnets[1].Id)
+			assert.Equal(t, controlPlaneEndpointSubnetRole, v.Subnets[2].Role)
+			assert.Equal(t, tt.endpointId, v.Subnets[2].Id)
+			assert.Equal(t, tt.endpointType, v.Subnets[2].Type)
+		})
+	}
+}
+
+func TestSetExistingVCNCIDRs(t *testing.T) {
+	cidr := "10.0.0.0/16"
+	client := &fake.Client{
+		VCNs: map[string]*core.Vcn{
+			"single": {CidrBlock: &cidr},
+			"multi":  {CidrBlock: &cidr, CidrBlocks: []string{cidr, "10.1.0.0/16"}},
+		},
+	}
+	var tests = []struct {
+		name     string
+		v        *Variables
+		cidrs    []string
+		hasError bool
+	}{
+		{"no proxy", &Variables{VCNID: "single"}, nil, false},
+		{"quick create VCN", &Variables{VCNID: "single", QuickCreateVCN: true, ProxyEndpoint: "http://proxy"}, nil, false},
+		{"single CIDR", &Variables{VCNID: "single", ProxyEndpoint: "http://proxy"}, []string{cidr}, false},
+		{"multiple CIDRs", &Variables{VCNID: "multi", ProxyEndpoint: "http://proxy"}, []string{cidr, "10.1.0.0/16"}, false},
+		{"missing VCN", &Variables{VCNID: "missing", ProxyEndpoint: "http://proxy"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.v.setExistingVCNCIDRs(context.TODO(), client)
+			if tt.hasError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.cidrs, tt.v.ExistingVCNCIDRs)
+		})
+	}
+}
+
+func TestSetNetworkSecurityGroups(t *testing.T) {
+	nsg := func(vcnId, displayName string) *core.NetworkSecurityGroup {
+		return &core.NetworkSecurityGroup{VcnId: &vcnId, DisplayName: &displayName}
+	}
+	client := &fake.Client{
+		NetworkSecurityGroups: map[string]*core.NetworkSecurityGroup{
+			"cp":     nsg("vcn", "shared-control-plane"),
+			"worker": nsg("vcn", "shared-workers"),
+			"other":  nsg("other-vcn", "other"),
+		},
+	}
+	var tests = []struct {
+		name     string
+		v        *Variables
+		nsgs     []NetworkSecurityGroup
+		hasError bool
+	}{
+		{
+			"no network security groups",
+			&Variables{VCNID: "vcn"},
+			nil,
+			false,
+		},
+		{
+			"network security groups by role",
+			&Variables{VCNID: "vcn", ControlPlaneNSG: "cp", ControlPlaneEndpointNSG: "cp", WorkerNodeNSG: "worker"},
+			[]NetworkSecurityGroup{
+				{Id: "cp", Name: "shared-control-plane", Role: controlPlaneSubnetRole},
+				{Id: "cp", Name: "shared-control-plane", Role: controlPlaneEndpointSubnetRole},
+				{Id: "worker", Name: "shared-workers", Role: workerSubnetRole},
+			},
+			false,
+		},
+		{
+			"network security group in another VCN",
+			&Variables{VCNID: "vcn", WorkerNodeNSG: "other"},
+			nil,
+			true,
+		},
+		{
+			"missing network security group",
+			&Variables{VCNID: "vcn", WorkerNodeNSG: "missing"},
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.v.setNetworkSecurityGroups(context.TODO(), client)
+			if tt.hasError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.nsgs, tt.v.NetworkSecurityGroups)
+		})
+	}
+}
+
+func TestNodePoolHash(t *testing.T) {
+	v := &Variables{
+		KubernetesVersion: "v1.25.7",
+		NodePools: []NodePool{
+			{Name: "np-1", Shape: "VM.Standard.E4.Flex", Ocpus: 2},
+			{Name: "np-2", Shape: "VM.Standard.E4.Flex", Ocpus: 2},
+		},
+	}
+	v.SetHashes()
+	np1Hash, np2Hash := v.NodePools[0].Hash, v.NodePools[1].Hash
+	assert.NotEqual(t, np1Hash, np2Hash)
+
+	// scaling does not change the hash
+	v.NodePools[0].Replicas = 5
+	v.SetHashes()
+	assert.Equal(t, np1Hash, v.NodePools[0].Hash)
+
+	// changing one node pool only changes that node pool's hash
+	v.NodePools[0].Ocpus = 4
+	v.SetHashes()
+	assert.NotEqual(t, np1Hash, v.NodePools[0].Hash)
+	assert.Equal(t, np2Hash, v.NodePools[1].Hash)
+
+	// the boot volume size is part of the immutable machine template
+	v.NodePools[1].VolumeSize = 100
+	v.SetHashes()
+	assert.NotEqual(t, np2Hash, v.NodePools[1].Hash)
+	np2Hash = v.NodePools[1].Hash
+
+	// changing cluster values changes every hash
+	v.KubernetesVersion = "v1.26.2"
+	v.SetHashes()
+	assert.NotEqual(t, np2Hash, v.NodePools[1].Hash)
+}
+
+func TestSetupOCIAuth(t *testing.T) {
+	ki := k8sfake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "creds",
+			Namespace: "cattle-global-data",
+		},
+		Data: map[string][]byte{
+			"ocicredentialConfig-userId":             []byte("user"),
+			"ocicredentialConfig-fingerprint":        []byte("fingerprint"),
+			"ocicredentialConfig-tenancyId":          []byte("tenancy"),
+			"ocicredentialConfig-privateKeyContents": []byte("key"),
+		},
+	})
+
+	v := &Variables{
+		CloudCredentialId: "cattle-global-data:creds",
+	}
+	assert.NoError(t, SetupOCIAuth(context.TODO(), ki, v))
+	assert.Equal(t, "creds", v.CAPICredentialName)
+	assert.Equal(t, "user", v.User)
+	assert.Equal(t, "key", v.PrivateKey)
+	assert.Equal(t, AuthModeUserPrincipal, v.IdentityType())
+
+	v.AuthMode = AuthModeInstancePrincipal
+	assert.NoError(t, SetupOCIAuth(context.TODO(), ki, v))
+	assert.Empty(t, v.CAPICredentialName)
+	assert.Empty(t, v.User)
+	assert.Empty(t, v.PrivateKey)
+	assert.Equal(t, AuthModeInstancePrincipal, v.IdentityType())
+
+	// no cloud credential is needed without API keys
+	v = &Variables{
+		AuthMode: AuthModeWorkloadIdentity,
+	}
+	assert.NoError(t, SetupOCIAuth(context.TODO(), k8sfake.NewSimpleClientset(), v))
+	assert.False(t, v.UsesUserPrincipal())
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package variables
+
+import (
+	"context"
+	"github.com/verrazzano/kontainer-engine-driver-ociocne/pkg/version"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SetKubernetesVersion sets the Kubernetes version of the cluster.
+// When the version changes, the OCNE release and image tags move to the OCNE version mapping values for the new version.
+func (v *Variables) SetKubernetesVersion(ctx context.Context, ki kubernetes.Interface, kubernetesVersion string) error {
+	previousVersion := v.KubernetesVersion
+	v.KubernetesVersion = kubernetesVersion
+	if previousVersion == kubernetesVersion {
+		return nil
+	}
+	return v.adoptVersionDefaults(ctx, ki, previousVersion)
+}
+
+// adoptVersionDefaults sets the OCNE release and image tags from the OCNE version mapping.
+// If custom image tags are allowed, values that differ from the previous version's mapping are pinned by the user and kept.
+func (v *Variables) adoptVersionDefaults(ctx context.Context, ki kubernetes.Interface, previousVersion string) error {
+	defaults, err := version.GetDefaults(ctx, ki, v.KubernetesVersion)
+	if err != nil {
+		return err
+	}
+	// versions outside the mapping are rejected by the upgrade checks
+	if defaults == nil {
+		return nil
+	}
+	previous, err := version.GetDefaults(ctx, ki, previousVersion)
+	if err != nil {
+		return err
+	}
+	if previous == nil {
+		previous = &version.Defaults{}
+	}
+
+	adopt := func(value *string, previousDefault, newDefault string) {
+		if v.AllowCustomImageTags && *value != "" && *value != previousDefault {
+			return
+		}
+		*value = newDefault
+	}
+	adopt(&v.OCNEVersion, previous.Release, defaults.Release)
+	adopt(&v.ETCDImageTag, previous.ContainerImages.ETCD, defaults.ContainerImages.ETCD)
+	adopt(&v.CoreDNSImageTag, previous.ContainerImages.CoreDNS, defaults.ContainerImages.CoreDNS)
+	adopt(&v.TigeraTag, previous.ContainerImages.TigeraOperator, defaults.ContainerImages.TigeraOperator)
+	return nil
+}
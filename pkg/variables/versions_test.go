@@ -0,0 +1,96 @@
+// Copyright (c) 2023, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package variables
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+const testVersionMapping = `v1.25.7:
+  Release: "1.6"
+  container-images:
+    coredns: v1.9.3
+    etcd: 3.5.6
+    tigera-operator: v1.29.0
+v1.26.6:
+  Release: "1.7"
+  container-images:
+    coredns: v1.10.1
+    etcd: 3.5.7
+    tigera-operator: v1.29.3`
+
+func TestSetKubernetesVersion(t *testing.T) {
+	ki := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ocne-metadata",
+			Namespace: "verrazzano-capi",
+		},
+		Data: map[string]string{
+			"mapping": testVersionMapping,
+		},
+	})
+	var tests = []struct {
+		name        string
+		version     string
+		allowCustom bool
+		etcdTag     string
+		expected    Variables
+	}{
+		{
+			"same version keeps tags",
+			"v1.25.7",
+			false,
+			"custom",
+			Variables{KubernetesVersion: "v1.25.7", OCNEVersion: "1.6", ETCDImageTag: "custom", CoreDNSImageTag: "v1.9.3", TigeraTag: "v1.29.0"},
+		},
+		{
+			"upgrade adopts mapping",
+			"v1.26.6",
+			false,
+			"custom",
+			Variables{KubernetesVersion: "v1.26.6", OCNEVersion: "1.7", ETCDImageTag: "3.5.7", CoreDNSImageTag: "v1.10.1", TigeraTag: "v1.29.3"},
+		},
+		{
+			"upgrade keeps pinned tags",
+			"v1.26.6",
+			true,
+			"custom",
+			Variables{KubernetesVersion: "v1.26.6", OCNEVersion: "1.7", ETCDImageTag: "custom", CoreDNSImageTag: "v1.10.1", TigeraTag: "v1.29.3", AllowCustomImageTags: true},
+		},
+		{
+			"upgrade with allowed custom tags adopts unpinned tags",
+			"v1.26.6",
+			true,
+			"3.5.6",
+			Variables{KubernetesVersion: "v1.26.6", OCNEVersion: "1.7", ETCDImageTag: "3.5.7", CoreDNSImageTag: "v1.10.1", TigeraTag: "v1.29.3", AllowCustomImageTags: true},
+		},
+		{
+			"version not in mapping keeps tags",
+			"v1.27.0",
+			false,
+			"custom",
+			Variables{KubernetesVersion: "v1.27.0", OCNEVersion: "1.6", ETCDImageTag: "custom", CoreDNSImageTag: "v1.9.3", TigeraTag: "v1.29.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := Variables{
+				KubernetesVersion:    "v1.25.7",
+				OCNEVersion:          "1.6",
+				ETCDImageTag:         tt.etcdTag,
+				CoreDNSImageTag:      "v1.9.3",
+				TigeraTag:            "v1.29.0",
+				AllowCustomImageTags: tt.allowCustom,
+			}
+			assert.NoError(t, v.SetKubernetesVersion(context.TODO(), ki, tt.version))
+			assert.Equal(t, tt.expected, v)
+		})
+	}
+}
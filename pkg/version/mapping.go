@@ -22,7 +22,7 @@ const (
 )
 
 type Defaults struct {
-	Release         string `json:"Release"`
+	Release         string `json:"Release" yaml:"Release"`
 	ContainerImages struct {
 		Calico         string `json:"calico"`
 		CoreDNS        string `json:"coredns"`
@@ -60,6 +60,20 @@ func LoadDefaults(ctx context.Context, ki kubernetes.Interface) (*Defaults, erro
 	return defaults, nil
 }
 
+// GetDefaults returns the defaults for a Kubernetes version, or nil if the version is not in the OCNE version mapping
+func GetDefaults(ctx context.Context, ki kubernetes.Interface, kubernetesVersion string) (*Defaults, error) {
+	versions, err := getVersionMapping(ctx, ki)
+	if err != nil {
+		return nil, err
+	}
+	defaults, ok := versions[kubernetesVersion]
+	if !ok || defaults == nil {
+		return nil, nil
+	}
+	defaults.KubernetesVersion = kubernetesVersion
+	return defaults, nil
+}
+
 func getVersionMapping(ctx context.Context, ki kubernetes.Interface) (map[string]*Defaults, error) {
 	cm, err := ki.CoreV1().ConfigMaps(ocneConfigMapNamespace).Get(ctx, ocneConfigMapName, metav1.GetOptions{})
 	if err != nil {
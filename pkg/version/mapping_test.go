@@ -45,3 +45,29 @@ func TestLoadDefaults(t *testing.T) {
 	assert.Equal(t, "v1.29.0", defaults.ContainerImages.TigeraOperator)
 	assert.Equal(t, "3.5.6", defaults.ContainerImages.ETCD)
 }
+
+func TestGetDefaults(t *testing.T) {
+	ki := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ocneConfigMapName,
+			Namespace: ocneConfigMapNamespace,
+		},
+		Data: map[string]string{
+			"mapping": testCMData,
+		},
+	})
+
+	defaults, err := GetDefaults(context.TODO(), ki, "v1.24.8")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.24.8", defaults.KubernetesVersion)
+	assert.Equal(t, "1.5", defaults.Release)
+	assert.Equal(t, "3.5.3", defaults.ContainerImages.ETCD)
+
+	defaults, err = GetDefaults(context.TODO(), ki, "v1.26.2")
+	assert.NoError(t, err)
+	assert.Nil(t, defaults)
+
+	defaults, err = GetDefaults(context.TODO(), fake.NewSimpleClientset(), "v1.24.8")
+	assert.NoError(t, err)
+	assert.Nil(t, defaults)
+}